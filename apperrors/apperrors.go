@@ -0,0 +1,187 @@
+// Package apperrors defines the typed errors returned by services and
+// repositories, and the JSON envelope they are sent to API clients in.
+//
+// Every error response has the same shape:
+//
+//	{"error": {"code": "not_found", "message": "Channel not found", "details": {...}, "request_id": "..."}}
+package apperrors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ozencb/couchtube/logging"
+)
+
+// Code is the machine readable kind of an error.
+type Code string
+
+const (
+	CodeUnauthenticated  Code = "unauthenticated"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeValidation       Code = "validation_failed"
+	CodeConflict         Code = "conflict"
+	CodeTooManyRequests  Code = "too_many_requests"
+	CodeUpstream         Code = "upstream_failed"
+	CodeUnsupported      Code = "unsupported"
+	CodeUnavailable      Code = "unavailable"
+	CodeTimeout          Code = "timeout"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeInternal         Code = "internal"
+)
+
+var statuses = map[Code]int{
+	CodeUnauthenticated:  http.StatusUnauthorized,
+	CodeForbidden:        http.StatusForbidden,
+	CodeNotFound:         http.StatusNotFound,
+	CodeValidation:       http.StatusBadRequest,
+	CodeConflict:         http.StatusConflict,
+	CodeTooManyRequests:  http.StatusTooManyRequests,
+	CodeUpstream:         http.StatusBadGateway,
+	CodeUnsupported:      http.StatusNotImplemented,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+	CodeTimeout:          http.StatusGatewayTimeout,
+	CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	CodeInternal:         http.StatusInternalServerError,
+}
+
+// Error is an error with a code and a message that can be shown to clients.
+// The wrapped error, if any, is only logged.
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status the error is sent with.
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// WithDetails returns a copy of the error with details added.
+func (e *Error) WithDetails(details map[string]interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// Unauthenticated is for requests to admin endpoints without a valid token
+// or session.
+func Unauthenticated(message string) *Error {
+	return &Error{Code: CodeUnauthenticated, Message: message}
+}
+
+// Forbidden is for authenticated users who aren't allowed to do what they
+// asked for.
+func Forbidden(message string) *Error {
+	return &Error{Code: CodeForbidden, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Code: CodeNotFound, Message: message}
+}
+
+func Validation(message string) *Error {
+	return &Error{Code: CodeValidation, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Message: message}
+}
+
+// TooManyRequests is for clients that have to wait before trying again,
+// such as after guessing too many wrong PINs.
+func TooManyRequests(message string) *Error {
+	return &Error{Code: CodeTooManyRequests, Message: message}
+}
+
+// Upstream is for failures of a service CouchTube depends on, such as the
+// server hosting a submitted channel list.
+func Upstream(message string, err error) *Error {
+	return &Error{Code: CodeUpstream, Message: message, Err: err}
+}
+
+func Unsupported(message string, err error) *Error {
+	return &Error{Code: CodeUnsupported, Message: message, Err: err}
+}
+
+func Unavailable(message string) *Error {
+	return &Error{Code: CodeUnavailable, Message: message}
+}
+
+// Timeout is for requests that ran out of time, such as a query waiting on
+// a locked database past the request timeout.
+func Timeout(err error) *Error {
+	return &Error{Code: CodeTimeout, Message: "The request took too long", Err: err}
+}
+
+func MethodNotAllowed() *Error {
+	return &Error{Code: CodeMethodNotAllowed, Message: "Method not allowed"}
+}
+
+func Internal(message string, err error) *Error {
+	return &Error{Code: CodeInternal, Message: message, Err: err}
+}
+
+// From returns err as an *Error. Errors that aren't typed are internal
+// errors, sent to clients with message rather than their own text, unless
+// they come from a deadline running out.
+func From(err error, message string) *Error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout(err)
+	}
+	return Internal(message, err)
+}
+
+// Is reports whether err is an *Error with code.
+func Is(err error, code Code) bool {
+	var typed *Error
+	return errors.As(err, &typed) && typed.Code == code
+}
+
+type envelope struct {
+	Error body `json:"error"`
+}
+
+type body struct {
+	Code      Code                   `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// Write sends e to the client in the error envelope, along with the ID of
+// the request so the failure can be found in the logs.
+func Write(w http.ResponseWriter, r *http.Request, e *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status())
+	json.NewEncoder(w).Encode(envelope{Error: body{
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		RequestID: logging.RequestID(r.Context()),
+	}})
+}
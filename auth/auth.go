@@ -0,0 +1,137 @@
+// Package auth holds who a request was made by and what their role allows,
+// and the secrets used to tell.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/ozencb/couchtube/apperrors"
+)
+
+const (
+	MethodToken       = "token"
+	MethodSession     = "session"
+	MethodOIDC        = "oidc"
+	MethodCommandLine = "command_line"
+)
+
+// SessionCookie is the cookie carrying the ID of a web UI session.
+const SessionCookie = "couchtube_session"
+
+// DeviceCookie is the cookie carrying the device token of a browser, which
+// its lineup preferences are kept under while no user is signed in.
+const DeviceCookie = "couchtube_device"
+
+// Role decides what a user may do. Every role may do what the roles before
+// it may.
+type Role string
+
+const (
+	// RoleViewer may watch, like anonymous visitors.
+	RoleViewer Role = "viewer"
+	// RoleCurator may also edit the channels they own and triage reported
+	// videos.
+	RoleCurator Role = "curator"
+	// RoleAdmin may do everything, including imports, backups and managing
+	// users.
+	RoleAdmin Role = "admin"
+)
+
+var roleRanks = map[Role]int{RoleViewer: 1, RoleCurator: 2, RoleAdmin: 3}
+
+func ParseRole(value string) (Role, error) {
+	role := Role(value)
+	if _, ok := roleRanks[role]; !ok {
+		return "", apperrors.Validation("Role must be viewer, curator or admin").WithDetails(map[string]interface{}{"role": value})
+	}
+	return role, nil
+}
+
+// Includes reports whether r may do everything other may.
+func (r Role) Includes(other Role) bool {
+	return roleRanks[r] >= roleRanks[other] && roleRanks[other] > 0
+}
+
+// Identity is an authenticated user or API token.
+type Identity struct {
+	// UserID is the ID of the signed in user, or 0 for API tokens, admin
+	// password sign-ins and commands.
+	UserID int
+	// Name is the name of the user or API token, or "admin" for admin
+	// password sign-ins.
+	Name string
+	Role Role
+	// MaxRating is the highest content rating the user may watch, or empty
+	// for no limit.
+	MaxRating string
+	// Method is how the request was authenticated, MethodToken or
+	// MethodSession, or MethodOIDC while signing in.
+	Method string
+	// Issuer and Subject identify a user at their OpenID Connect provider.
+	// They are only set while signing in with it.
+	Issuer  string
+	Subject string
+}
+
+// CommandLine is the identity commands run with. They have direct access to
+// the database anyway, so they act as admin.
+var CommandLine = &Identity{Name: "command line", Role: RoleAdmin, Method: MethodCommandLine}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying identity.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity carried by ctx, or nil for anonymous
+// requests.
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+type deviceKey struct{}
+
+// WithDevice returns a copy of ctx carrying the device token of the browser
+// the request came from.
+func WithDevice(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, deviceKey{}, token)
+}
+
+// DeviceFromContext returns the device token carried by ctx, or "" if the
+// browser has none yet.
+func DeviceFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(deviceKey{}).(string)
+	return token
+}
+
+// Require returns the identity carried by ctx if its role includes role.
+func Require(ctx context.Context, role Role) (*Identity, error) {
+	identity := FromContext(ctx)
+	if identity == nil {
+		return nil, apperrors.Unauthenticated("Sign in or send an API token")
+	}
+	if !identity.Role.Includes(role) {
+		return nil, apperrors.Forbidden("Your role doesn't allow this").WithDetails(map[string]interface{}{"required_role": role})
+	}
+	return identity, nil
+}
+
+// NewSecret returns a random secret with 256 bits of entropy, starting with
+// prefix so it can be recognized, e.g. in a leaked config file.
+func NewSecret(prefix string) string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// Hash returns the hash secrets are stored and looked up by. Secrets are
+// random, so a fast hash is enough.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
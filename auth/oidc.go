@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/ozencb/couchtube/apperrors"
+	"golang.org/x/oauth2"
+)
+
+const discoverySuffix = "/.well-known/openid-configuration"
+
+// OIDCConfig configures sign-in with an OpenID Connect provider.
+type OIDCConfig struct {
+	// DiscoveryURL is the issuer URL of the provider, with or without the
+	// /.well-known/openid-configuration suffix.
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends browsers back to, the
+	// /api/oidc/callback endpoint as reached by them.
+	RedirectURL string
+	Scopes      []string
+	// RoleClaim names the claim, a string or a list of strings, that is
+	// mapped to roles.
+	RoleClaim string
+	// AdminValues and CuratorValues are the values of RoleClaim that make a
+	// user an admin or a curator. Everyone else is a viewer.
+	AdminValues   []string
+	CuratorValues []string
+}
+
+// OIDCProvider signs users in with the authorization code flow and PKCE.
+type OIDCProvider struct {
+	config OIDCConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
+	if config.ClientID == "" {
+		return nil, errors.New("an OIDC client ID is required")
+	}
+	if config.RedirectURL == "" {
+		return nil, errors.New("an OIDC redirect URL is required")
+	}
+
+	config.DiscoveryURL = strings.TrimSuffix(strings.TrimSuffix(config.DiscoveryURL, discoverySuffix), "/")
+	if !slices.Contains(config.Scopes, oidc.ScopeOpenID) {
+		config.Scopes = append([]string{oidc.ScopeOpenID}, config.Scopes...)
+	}
+
+	return &OIDCProvider{config: config}, nil
+}
+
+// discover fetches the configuration of the provider on first use, and
+// again after a failure, so CouchTube starts while the provider is down.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.config.DiscoveryURL)
+		if err != nil {
+			return nil, apperrors.Upstream("Failed to reach the sign-in provider", err)
+		}
+		p.provider = provider
+	}
+
+	return p.provider, nil
+}
+
+func (p *OIDCProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.config.Scopes,
+	}
+}
+
+// OIDCFlow holds the secrets of one sign-in between sending the browser to
+// the provider and it coming back. It is kept in a cookie of the browser.
+type OIDCFlow struct {
+	State    string
+	Verifier string
+	Nonce    string
+}
+
+func NewOIDCFlow() OIDCFlow {
+	return OIDCFlow{
+		State:    NewSecret(""),
+		Verifier: oauth2.GenerateVerifier(),
+		Nonce:    NewSecret(""),
+	}
+}
+
+func (f OIDCFlow) String() string {
+	return f.State + "." + f.Verifier + "." + f.Nonce
+}
+
+func ParseOIDCFlow(value string) (OIDCFlow, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return OIDCFlow{}, false
+	}
+	return OIDCFlow{State: parts[0], Verifier: parts[1], Nonce: parts[2]}, true
+}
+
+// AuthCodeURL returns the URL to send the browser to for signing in.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, flow OIDCFlow) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return p.oauth2Config(provider).AuthCodeURL(flow.State, oauth2.S256ChallengeOption(flow.Verifier), oidc.Nonce(flow.Nonce)), nil
+}
+
+// Exchange redeems the code the provider sent the browser back with, and
+// returns the identity of the user with the role their claims map to. Their
+// name is only for display, the issuer and subject identify them.
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, flow OIDCFlow) (*Identity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return nil, apperrors.Upstream("Failed to redeem the sign-in code", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, apperrors.Upstream("The sign-in provider sent no ID token", nil)
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, apperrors.Upstream("The sign-in provider sent an invalid ID token", err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return nil, apperrors.Upstream("The sign-in provider sent an invalid ID token", errors.New("nonce does not match"))
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, apperrors.Upstream("The sign-in provider sent an invalid ID token", err)
+	}
+
+	name := idToken.Subject
+	for _, key := range []string{"preferred_username", "email"} {
+		if value, ok := claims[key].(string); ok && value != "" {
+			name = value
+			break
+		}
+	}
+
+	return &Identity{
+		Name:    name,
+		Role:    p.role(claims[p.config.RoleClaim]),
+		Method:  MethodOIDC,
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+	}, nil
+}
+
+// role maps the role claim, a string or a list of strings, to the highest
+// role one of its values gives.
+func (p *OIDCProvider) role(claim interface{}) Role {
+	var values []string
+	switch claim := claim.(type) {
+	case string:
+		values = []string{claim}
+	case []interface{}:
+		for _, value := range claim {
+			values = append(values, fmt.Sprint(value))
+		}
+	}
+
+	role := RoleViewer
+	for _, value := range values {
+		if slices.Contains(p.config.AdminValues, value) {
+			return RoleAdmin
+		}
+		if slices.Contains(p.config.CuratorValues, value) {
+			role = RoleCurator
+		}
+	}
+	return role
+}
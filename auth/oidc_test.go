@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+)
+
+const testClientID = "couchtube"
+
+// testProvider is an OpenID Connect provider serving discovery, token and
+// JWKS endpoints. Codes are issued by the test itself from the URL the
+// browser would be sent to, and redeemed only with the matching PKCE
+// verifier.
+type testProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]testGrant
+}
+
+type testGrant struct {
+	challenge string
+	nonce     string
+	claims    map[string]interface{}
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key, grants: make(map[string]testGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// issue returns a code for a user with claims, as the provider would after
+// the browser went to authURL and signed in.
+func (p *testProvider) issue(t *testing.T, authURL string, claims map[string]interface{}) string {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if method := query.Get("code_challenge_method"); method != "S256" {
+		t.Fatalf("code_challenge_method is %q, want S256", method)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code := fmt.Sprintf("code-%d", len(p.grants)+1)
+	p.grants[code] = testGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	return code
+}
+
+func (p *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   p.URL,
+		"aud":   testClientID,
+		"sub":   "1234",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": grant.nonce,
+	}
+	for key, value := range grant.claims {
+		claims[key] = value
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     p.sign(claims),
+	})
+}
+
+// sign returns claims as a JWT signed with RS256.
+func (p *testProvider) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, hash[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func newTestOIDCProvider(t *testing.T, p *testProvider) *OIDCProvider {
+	t.Helper()
+
+	provider, err := NewOIDCProvider(OIDCConfig{
+		DiscoveryURL:  p.URL + discoverySuffix,
+		ClientID:      testClientID,
+		ClientSecret:  "secret",
+		RedirectURL:   "https://tv.example.org/api/oidc/callback",
+		RoleClaim:     "groups",
+		AdminValues:   []string{"couchtube-admins"},
+		CuratorValues: []string{"couchtube-curators"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	provider := newTestOIDCProvider(t, newTestProvider(t))
+	flow := NewOIDCFlow()
+
+	authURL, err := provider.AuthCodeURL(context.Background(), flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+
+	sum := sha256.Sum256([]byte(flow.Verifier))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "https://tv.example.org/api/oidc/callback",
+		"state":                 flow.State,
+		"nonce":                 flow.Nonce,
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+		"scope":                 "openid",
+	}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s is %q, want %q", key, got, value)
+		}
+	}
+	if query.Has("code_verifier") {
+		t.Error("the verifier is sent to the browser")
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	p := newTestProvider(t)
+	provider := newTestOIDCProvider(t, p)
+
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		wantName string
+		wantRole Role
+	}{
+		{
+			name:     "admin group",
+			claims:   map[string]interface{}{"preferred_username": "parents", "groups": []string{"family", "couchtube-admins"}},
+			wantName: "parents",
+			wantRole: RoleAdmin,
+		},
+		{
+			name:     "curator group as a string",
+			claims:   map[string]interface{}{"preferred_username": "kids", "groups": "couchtube-curators"},
+			wantName: "kids",
+			wantRole: RoleCurator,
+		},
+		{
+			name:     "admin wins over curator",
+			claims:   map[string]interface{}{"preferred_username": "parents", "groups": []string{"couchtube-curators", "couchtube-admins"}},
+			wantName: "parents",
+			wantRole: RoleAdmin,
+		},
+		{
+			name:     "no matching group",
+			claims:   map[string]interface{}{"email": "guest@example.org", "groups": []string{"family"}},
+			wantName: "guest@example.org",
+			wantRole: RoleViewer,
+		},
+		{
+			name:     "no claims but the subject",
+			claims:   nil,
+			wantName: "1234",
+			wantRole: RoleViewer,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			flow := NewOIDCFlow()
+			authURL, err := provider.AuthCodeURL(ctx, flow)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := provider.Exchange(ctx, p.issue(t, authURL, test.claims), flow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Name != test.wantName || identity.Role != test.wantRole {
+				t.Errorf("got %s as %s, want %s as %s", identity.Name, identity.Role, test.wantName, test.wantRole)
+			}
+			if identity.Issuer != p.URL || identity.Subject != "1234" {
+				t.Errorf("got subject %s of %s, want 1234 of %s", identity.Subject, identity.Issuer, p.URL)
+			}
+			if identity.Method != MethodOIDC {
+				t.Errorf("method is %s, want %s", identity.Method, MethodOIDC)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeRefused(t *testing.T) {
+	p := newTestProvider(t)
+	provider := newTestOIDCProvider(t, p)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		tamper func(flow *OIDCFlow)
+	}{
+		{name: "wrong verifier", tamper: func(flow *OIDCFlow) { flow.Verifier = NewOIDCFlow().Verifier }},
+		{name: "wrong nonce", tamper: func(flow *OIDCFlow) { flow.Nonce = NewOIDCFlow().Nonce }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flow := NewOIDCFlow()
+			authURL, err := provider.AuthCodeURL(ctx, flow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := p.issue(t, authURL, map[string]interface{}{"groups": "couchtube-admins"})
+
+			test.tamper(&flow)
+			identity, err := provider.Exchange(ctx, code, flow)
+			if !apperrors.Is(err, apperrors.CodeUpstream) {
+				t.Errorf("got %v, %v, want an upstream error", identity, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/ozencb/couchtube/config"
+	"github.com/ozencb/couchtube/db"
+	repo "github.com/ozencb/couchtube/repositories"
+	"github.com/ozencb/couchtube/services"
+)
+
+const backupUsage = `Usage: couchtube backup [file]
+
+Writes a snapshot of the database to file, or to backup_dir when no file is
+given. It is safe to run while the server is running.`
+
+const restoreUsage = `Usage: couchtube restore <file>
+
+Replaces all data in the database with the snapshot in file.`
+
+func runBackup(args []string) {
+	flags := newFlagSet("backup", backupUsage)
+	cfg := loadConfig(flags, args)
+	args = flags.Args()
+	if len(args) > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	backupService := newBackupService(cfg)
+	defer db.CloseConnector()
+
+	if len(args) == 1 {
+		if err := backupService.Snapshot(ctx, args[0]); err != nil {
+			fatal("Backup failed", err)
+		}
+		slog.Info("Backup written", "path", args[0])
+		return
+	}
+
+	if backupService.Dir == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path, err := backupService.Create(ctx)
+	if err != nil {
+		fatal("Backup failed", err)
+	}
+	slog.Info("Backup written", "path", path)
+}
+
+func runRestore(args []string) {
+	flags := newFlagSet("restore", restoreUsage)
+	cfg := loadConfig(flags, args)
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	backupService := newBackupService(cfg)
+	defer db.CloseConnector()
+
+	if err := backupService.Restore(ctx, args[0]); err != nil {
+		fatal("Restore failed", err)
+	}
+	slog.Info("Database restored", "path", args[0])
+}
+
+func newBackupService(cfg *config.Config) *services.BackupService {
+	dbInstance := openDatabase(cfg)
+	return services.NewBackupService(repo.NewTxManager(dbInstance), repo.NewChannelRepository(dbInstance, db.GetDialect(), slog.Default()), cfg.BackupDir, cfg.BackupRetention, slog.Default())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ozencb/couchtube/db"
+)
+
+const channelsUsage = `Usage: couchtube channels <command>
+
+Commands:
+  list   List all channels with their slug, number, source and lineup`
+
+const videosUsage = `Usage: couchtube videos <command>
+
+Commands:
+  invalidate <id>   Quarantine a video right away, taking it off air`
+
+func runChannels(args []string) {
+	flags := newFlagSet("channels", channelsUsage)
+	cfg := loadConfig(flags, args)
+	args = flags.Args()
+	if len(args) != 1 || args[0] != "list" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	dbInstance := openDatabase(cfg)
+	defer db.CloseConnector()
+	mediaService := newMediaService(dbInstance, cfg)
+
+	channels, err := mediaService.ListChannels(ctx)
+	if err != nil {
+		fatal("Failed to list channels", err)
+	}
+	users, err := newAuthService(dbInstance, cfg, nil).ListUsers(ctx)
+	if err != nil {
+		fatal("Failed to list users", err)
+	}
+	names := make(map[int]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNUMBER\tSLUG\tNAME\tSOURCE\tLINEUP")
+	for _, channel := range channels {
+		lineup := "shared"
+		if channel.ProfileID != nil {
+			lineup = names[*channel.ProfileID]
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", channel.ID, channel.Number, channel.Slug, channel.Name, channel.Source, lineup)
+	}
+	w.Flush()
+}
+
+func runVideos(args []string) {
+	flags := newFlagSet("videos", videosUsage)
+	cfg := loadConfig(flags, args)
+	args = flags.Args()
+	if len(args) != 2 || args[0] != "invalidate" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	mediaService := newMediaService(openDatabase(cfg), cfg)
+	defer db.CloseConnector()
+
+	if err := mediaService.QuarantineVideo(ctx, args[1]); err != nil {
+		fatal("Failed to quarantine video", err)
+	}
+	slog.Info("Video quarantined", "video_id", args[1])
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+const configUsage = `Usage: couchtube config print [flags]
+
+Shows the value of every setting and where it came from: the default, the
+config file, the environment or a flag.`
+
+func runConfig(args []string) {
+	flags := newFlagSet("config", configUsage)
+	if len(args) == 0 || args[0] != "print" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cfg := loadConfig(flags, args[1:])
+
+	if cfg.File != "" {
+		fmt.Printf("Config file: %s\n\n", cfg.File)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, setting := range cfg.Settings() {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Key, setting.Value, setting.Source)
+	}
+	w.Flush()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/ozencb/couchtube/db"
+)
+
+const exportUsage = `Usage: couchtube export [-profile name] [-channel ref]... [-o file]
+
+Writes the shared lineup, or the lineup of a user, as a channel list JSON
+that can be imported again.`
+
+// stringList collects the values of a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runExport(args []string) {
+	flags := newFlagSet("export", exportUsage)
+	var channels stringList
+	flags.Var(&channels, "channel", "slug, number or ID of a channel to export; repeat for several")
+	output := flags.String("o", "", "file to write to instead of stdout")
+	profile := flags.String("profile", "", "user whose lineup to export instead of the shared one")
+	cfg := loadConfig(flags, args)
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	mediaService := newMediaService(openDatabase(cfg), cfg)
+	defer db.CloseConnector()
+
+	export, err := mediaService.ExportChannels(ctx, *profile, channels)
+	if err != nil {
+		fatal("Export failed", err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fatal("Failed to create output file", err)
+		}
+		defer out.Close()
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		fatal("Failed to write export", err)
+	}
+}
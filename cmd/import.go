@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ozencb/couchtube/db"
+	"github.com/ozencb/couchtube/services"
+)
+
+const importUsage = `Usage: couchtube import [-profile name] <file|url>
+
+Imports a channel list, adding, updating and removing channels so the
+shared lineup, or the lineup of a user, matches it. Unchanged channels keep
+their ID, slug and number. A user with a lineup of their own watches it
+instead of the shared one.`
+
+const validateUsage = `Usage: couchtube validate <file|url>
+
+Checks a channel list and reports the channels and videos an import would
+skip. Exits with status 1 if there are any.`
+
+func runImport(args []string) {
+	flags := newFlagSet("import", importUsage)
+	profile := flags.String("profile", "", "user whose lineup to import into instead of the shared one")
+	cfg := loadConfig(flags, args)
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	channels, err := services.LoadChannelList(ctx, args[0])
+	if err != nil {
+		fatal("Failed to load channel list", err)
+	}
+
+	mediaService := newMediaService(openDatabase(cfg), cfg)
+	defer db.CloseConnector()
+
+	summary, err := mediaService.ImportChannels(ctx, *profile, channels)
+	if err != nil {
+		fatal("Import failed", err)
+	}
+	slog.Info("Channel list imported", "source", args[0], "profile", *profile, "summary", summary.String())
+}
+
+func runValidate(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, validateUsage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	channels, err := services.LoadChannelList(ctx, args[0])
+	if err != nil {
+		fatal("Failed to load channel list", err)
+	}
+
+	problems := services.ValidateChannels(channels)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid: %d channels\n", args[0], len(channels.Channels))
+}
@@ -1,71 +1,198 @@
 package main
 
 import (
-	"log"
-	"net/http"
-
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ozencb/couchtube/auth"
 	"github.com/ozencb/couchtube/config"
 	"github.com/ozencb/couchtube/db"
-	"github.com/ozencb/couchtube/handlers"
-
-	"github.com/ozencb/couchtube/middleware"
+	"github.com/ozencb/couchtube/logging"
 	repo "github.com/ozencb/couchtube/repositories"
 	"github.com/ozencb/couchtube/services"
 )
 
-type Route struct {
-	Path     string
-	Handler  http.HandlerFunc
-	Readonly bool
-}
+const usage = `Usage: couchtube [command] [arguments]
+
+Commands:
+  serve                          Start the server (default)
+  import <file|url>              Import a channel list, keeping unchanged channels
+  export                         Write the lineup as a channel list
+  validate <file|url>            Check a channel list without importing it
+  schedule -channel X [-at T]    Show what a channel plays at a given time
+  channels list                  List channels
+  videos invalidate <id>         Take a video off air
+  tokens <command>               Create, list and revoke admin API tokens
+  users <command>                Add, list and remove users and set their roles
+  migrate <command>              Manage database migrations
+  backup [file]                  Write a snapshot of the database
+  restore <file>                 Replace all data with a snapshot
+  config print                   Show the effective settings and their sources
+
+Every command takes flags for all settings, like -port or -database-url,
+before its arguments. Run "couchtube <command> -h" to list them.`
 
-func registerRoutes(mux *http.ServeMux, routes []Route) {
-	for _, route := range routes {
-		handler := route.Handler
+func main() {
+	if len(os.Args) < 2 {
+		runServe(nil)
+		return
+	}
 
-		if route.Readonly {
-			handler = middleware.ReadOnlyGuard(handler)
-		}
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "serve":
+		runServe(args)
+	case "import":
+		runImport(args)
+	case "export":
+		runExport(args)
+	case "validate":
+		runValidate(args)
+	case "schedule":
+		runSchedule(args)
+	case "channels":
+		runChannels(args)
+	case "videos":
+		runVideos(args)
+	case "tokens":
+		runTokens(args)
+	case "users":
+		runUsers(args)
+	case "migrate":
+		runMigrate(args)
+	case "backup":
+		runBackup(args)
+	case "restore":
+		runRestore(args)
+	case "config":
+		runConfig(args)
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
 
-		mux.Handle(route.Path, handler)
+// newFlagSet creates the flags of a command, printing usage on -h or errors.
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flags.PrintDefaults()
 	}
+	return flags
 }
 
-func main() {
-	// Initialize the database
-	dbInstance, err := db.GetDbConnection()
+// loadConfig parses args with a flag for every setting added to flags, loads
+// the configuration and sets up the default logger from it.
+func loadConfig(flags *flag.FlagSet, args []string) *config.Config {
+	loader := config.NewLoader(flags)
+	flags.Parse(args)
+
+	cfg, err := loader.Load()
 	if err != nil {
-		log.Fatalf("Database initialization failed: %v", err)
+		fatal("Failed to load configuration", err)
 	}
-	defer db.CloseConnector()
 
-	db.InitDatabase(dbInstance)
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fatal("Failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
 
-	// Initialize Repositories
-	txManager := repo.NewTxManager(dbInstance)
-	channelRepo := repo.NewChannelRepository(dbInstance)
-	videoRepo := repo.NewVideoRepository(dbInstance)
+	return cfg
+}
 
-	// Initialize Services
-	mediaService := services.NewMediaService(txManager, channelRepo, videoRepo)
+// signalContext returns a context that is canceled on SIGINT or SIGTERM, so
+// a command stops its queries and requests instead of being killed midway.
+// Calling stop lets a second signal kill the process again. Commands act as
+// admin, since they have access to the database anyway.
+func signalContext() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(auth.WithIdentity(context.Background(), auth.CommandLine), os.Interrupt, syscall.SIGTERM)
+}
 
-	// Initialize Handlers with services
-	mediaHandler := handlers.NewMediaHandler(mediaService)
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	readonlyEnabled := config.GetReadonlyMode()
+// openDatabase connects to the database and brings its schema up to date
+// for commands that work on it directly.
+func openDatabase(cfg *config.Config) *sql.DB {
+	dbInstance, err := db.GetDbConnection(cfg)
+	if err != nil {
+		fatal("Database initialization failed", err)
+	}
+	if err := db.Migrate(dbInstance); err != nil {
+		fatal("Failed to migrate database", err)
+	}
+
+	return dbInstance
+}
+
+// newOIDCProvider returns the OpenID Connect provider to sign in with, or
+// nil when it is not configured.
+func newOIDCProvider(cfg *config.Config) *auth.OIDCProvider {
+	if cfg.OIDCDiscoveryURL == "" {
+		return nil
+	}
 
-	routes := []Route{
-		{Path: "/", Handler: http.FileServer(http.Dir("./static")).ServeHTTP, Readonly: false},
-		{Path: "/api/channels", Handler: mediaHandler.FetchAllChannels, Readonly: false},
-		{Path: "/api/current-video", Handler: mediaHandler.GetCurrentVideo, Readonly: false},
-		{Path: "/api/submit-list", Handler: mediaHandler.SubmitList, Readonly: readonlyEnabled},
-		{Path: "/api/invalidate-video", Handler: mediaHandler.InvalidateVideo, Readonly: readonlyEnabled},
-		{Path: "/api/config", Handler: handlers.GetConfigs, Readonly: false},
+	provider, err := auth.NewOIDCProvider(auth.OIDCConfig{
+		DiscoveryURL:  cfg.OIDCDiscoveryURL,
+		ClientID:      cfg.OIDCClientID,
+		ClientSecret:  cfg.OIDCClientSecret,
+		RedirectURL:   cfg.OIDCRedirectURL,
+		Scopes:        strings.Fields(cfg.OIDCScopes),
+		RoleClaim:     cfg.OIDCRoleClaim,
+		AdminValues:   splitList(cfg.OIDCAdminRoles),
+		CuratorValues: splitList(cfg.OIDCCuratorRoles),
+	})
+	if err != nil {
+		fatal("OpenID Connect initialization failed", err)
 	}
-	registerRoutes(http.DefaultServeMux, routes)
+	return provider
+}
 
-	port := config.GetPort()
+// splitList splits a comma separated setting, dropping empty values.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func newAuthService(dbInstance *sql.DB, cfg *config.Config, oidcProvider *auth.OIDCProvider) *services.AuthService {
+	return services.NewAuthService(
+		repo.NewAuthRepository(dbInstance, db.GetDialect(), slog.Default()),
+		repo.NewUserRepository(dbInstance, db.GetDialect(), slog.Default()),
+		cfg.AdminPassword,
+		cfg.SessionTTL,
+		oidcProvider,
+		slog.Default(),
+	)
+}
 
-	log.Println("Server starting on port", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+func newMediaService(dbInstance *sql.DB, cfg *config.Config) *services.MediaService {
+	return services.NewMediaService(
+		repo.NewTxManager(dbInstance),
+		repo.NewChannelRepository(dbInstance, db.GetDialect(), slog.Default()),
+		repo.NewVideoRepository(dbInstance, db.GetDialect(), slog.Default()),
+		repo.NewUserRepository(dbInstance, db.GetDialect(), slog.Default()),
+		repo.NewPreferenceRepository(dbInstance, db.GetDialect(), slog.Default()),
+		cfg,
+		slog.Default(),
+	)
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/ozencb/couchtube/db"
+	"github.com/ozencb/couchtube/db/migrations"
+)
+
+const migrateUsage = `Usage: couchtube migrate <command>
+
+Commands:
+  status     List migrations and whether they are applied
+  up         Apply all pending migrations
+  down [n]   Revert the last n applied migrations (default 1)`
+
+func runMigrate(args []string) {
+	flags := newFlagSet("migrate", migrateUsage)
+	cfg := loadConfig(flags, args)
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	dbInstance, err := db.GetDbConnection(cfg)
+	if err != nil {
+		fatal("Database initialization failed", err)
+	}
+	defer db.CloseConnector()
+
+	switch args[0] {
+	case "status":
+		migrator, err := migrations.NewMigrator(dbInstance, db.GetDialect())
+		if err != nil {
+			fatal("Failed to load migrations", err)
+		}
+		statuses, err := migrator.Status()
+		if err != nil {
+			fatal("Failed to read migration status", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, applied)
+		}
+	case "up":
+		if err := db.Migrate(dbInstance); err != nil {
+			fatal("Migration failed", err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fatal("Invalid number of migrations to revert", fmt.Errorf("%q is not a positive number", args[1]))
+			}
+		}
+		migrator, err := migrations.NewMigrator(dbInstance, db.GetDialect())
+		if err != nil {
+			fatal("Failed to load migrations", err)
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			slog.Info("Reverted migration", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			fatal("Migration failed", err)
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
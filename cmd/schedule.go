@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ozencb/couchtube/db"
+)
+
+const scheduleUsage = `Usage: couchtube schedule -channel ref [-at time]
+
+Shows the video a channel plays at a given time. The time is either RFC 3339,
+like 2024-05-01T20:00:00Z, or a time of day like 20:00 for today.`
+
+func runSchedule(args []string) {
+	flags := newFlagSet("schedule", scheduleUsage)
+	channelRef := flags.String("channel", "", "slug, number or ID of the channel")
+	atValue := flags.String("at", "", "time to look at (default now)")
+	cfg := loadConfig(flags, args)
+
+	if *channelRef == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	at, err := parseScheduleTime(*atValue, time.Now())
+	if err != nil {
+		fatal("Invalid -at", err)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	mediaService := newMediaService(openDatabase(cfg), cfg)
+	defer db.CloseConnector()
+
+	channel, err := mediaService.FindChannel(ctx, *channelRef)
+	if err != nil {
+		fatal("Failed to find channel", err)
+	}
+	video, err := mediaService.GetVideoAt(ctx, channel, at)
+	if err != nil {
+		fatal("Failed to load schedule", err)
+	}
+	if video == nil {
+		fmt.Printf("%s has nothing on air\n", channel.Name)
+		return
+	}
+
+	offset := time.Duration(video.SectionStart) * time.Second
+	remaining := time.Duration(video.SectionEnd-video.SectionStart) * time.Second
+	fmt.Printf("%s at %s: %s (%s) at %s, %s left in the section\n",
+		channel.Name, at.Format(time.RFC3339), video.ID, video.Source, offset, remaining)
+}
+
+func parseScheduleTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	if clock, err := time.Parse("15:04", value); err == nil {
+		return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location()), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 or HH:MM", value)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ozencb/couchtube/db"
+	"github.com/ozencb/couchtube/handlers"
+	"github.com/ozencb/couchtube/library"
+	"github.com/ozencb/couchtube/metrics"
+
+	"github.com/ozencb/couchtube/middleware"
+	repo "github.com/ozencb/couchtube/repositories"
+	"github.com/ozencb/couchtube/services"
+)
+
+type Route struct {
+	Path    string
+	Handler http.HandlerFunc
+	Access  middleware.Access
+}
+
+// registerRoutes adds routes to mux, requiring the role each one asks for.
+// In read-only mode, every route that isn't Public is closed to changes,
+// whoever makes them.
+func registerRoutes(mux *http.ServeMux, routes []Route, readonly bool) {
+	for _, route := range routes {
+		handler := route.Handler
+
+		if readonly && route.Access != middleware.Public {
+			handler = middleware.ReadOnlyGuard(handler)
+		}
+		handler = middleware.Require(route.Access, handler)
+
+		mux.Handle(route.Path, middleware.Metrics(route.Path, handler))
+	}
+}
+
+// readHeaderTimeout keeps clients that never finish sending their request
+// from holding on to a connection.
+const readHeaderTimeout = 10 * time.Second
+
+const serveUsage = `Usage: couchtube serve [flags]
+
+Starts the server. This is what couchtube does without a command.`
+
+func runServe(args []string) {
+	flags := newFlagSet("serve", serveUsage)
+	cfg := loadConfig(flags, args)
+
+	// Canceled on SIGINT or SIGTERM. A signal during startup lets the
+	// current step finish, and the server then stops right away.
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Initialize the database
+	dbInstance, err := db.GetDbConnection(cfg)
+	if err != nil {
+		fatal("Database initialization failed", err)
+	}
+	defer db.CloseConnector()
+
+	if err := db.InitDatabase(dbInstance); err != nil {
+		fatal("Database initialization failed", err)
+	}
+
+	logger := slog.Default()
+
+	if cfg.ClientIPHeader != "" && len(cfg.TrustedProxies) == 0 {
+		logger.Warn("CLIENT_IP_HEADER is ignored until TRUSTED_PROXIES lists the proxies that set it")
+	}
+
+	healthHandler := handlers.NewHealthHandler()
+	healthHandler.AddCheck("database", func(ctx context.Context) error {
+		return db.Ping(ctx, dbInstance)
+	})
+	healthHandler.AddCheck("migrations", func(ctx context.Context) error {
+		return db.CheckMigrations(dbInstance)
+	})
+
+	authService := newAuthService(dbInstance, cfg, newOIDCProvider(cfg))
+
+	// Initialize Repositories
+	txManager := repo.NewTxManager(dbInstance)
+	channelRepo := repo.NewChannelRepository(dbInstance, db.GetDialect(), logger)
+	videoRepo := repo.NewVideoRepository(dbInstance, db.GetDialect(), logger)
+	userRepo := repo.NewUserRepository(dbInstance, db.GetDialect(), logger)
+	preferenceRepo := repo.NewPreferenceRepository(dbInstance, db.GetDialect(), logger)
+
+	// Initialize Services
+	mediaService := services.NewMediaService(txManager, channelRepo, videoRepo, userRepo, preferenceRepo, cfg, logger)
+	backupService := services.NewBackupService(txManager, channelRepo, cfg.BackupDir, cfg.BackupRetention, logger)
+
+	var libraryService *services.LibraryService
+	mediaLibraryPath := cfg.MediaLibraryPath
+	if mediaLibraryPath != "" {
+		prober, err := library.NewProber(cfg.MediaProber)
+		if err != nil {
+			fatal("Media library initialization failed", err)
+		}
+		libraryService = services.NewLibraryService(txManager, channelRepo, videoRepo, mediaLibraryPath, prober, logger)
+	}
+
+	// Initialize Handlers with services
+	mediaHandler := handlers.NewMediaHandler(mediaService, cfg)
+	backupHandler := handlers.NewBackupHandler(backupService, cfg)
+	settingsHandler := handlers.NewSettingsHandler(cfg, authService)
+	authHandler := handlers.NewAuthHandler(authService, cfg)
+	usersHandler := handlers.NewUsersHandler(authService, mediaService)
+
+	routes := []Route{
+		{Path: "/", Handler: http.FileServer(http.Dir("./static")).ServeHTTP, Access: middleware.Public},
+		{Path: "/api/channels", Handler: mediaHandler.FetchAllChannels, Access: middleware.Public},
+		{Path: "/api/current-video", Handler: mediaHandler.GetCurrentVideo, Access: middleware.Public},
+		{Path: "/api/submit-list", Handler: mediaHandler.SubmitList, Access: middleware.Admin},
+		{Path: "/api/invalidate-video", Handler: mediaHandler.InvalidateVideo, Access: middleware.PublicWrite},
+		{Path: "/api/export", Handler: mediaHandler.ExportChannels, Access: middleware.Public},
+		{Path: "/api/config", Handler: settingsHandler.GetConfigs, Access: middleware.Public},
+		{Path: "/api/login", Handler: authHandler.Login, Access: middleware.Public},
+		{Path: "/api/logout", Handler: authHandler.Logout, Access: middleware.Public},
+		{Path: "/api/profiles", Handler: authHandler.Profiles, Access: middleware.Public},
+		{Path: "/api/me/lineup", Handler: mediaHandler.Lineup, Access: middleware.PublicWrite},
+		{Path: "/api/oidc/login", Handler: authHandler.OIDCLogin, Access: middleware.Public},
+		{Path: "/api/oidc/callback", Handler: authHandler.OIDCCallback, Access: middleware.Public},
+		{Path: "/api/curator/channels", Handler: mediaHandler.CuratedChannels, Access: middleware.Curator},
+		{Path: "/api/curator/channel-videos", Handler: mediaHandler.ChannelVideos, Access: middleware.Curator},
+		{Path: "/api/admin/quarantined-videos", Handler: mediaHandler.FetchQuarantinedVideos, Access: middleware.Curator},
+		{Path: "/api/admin/restore-video", Handler: mediaHandler.RestoreVideo, Access: middleware.Curator},
+		{Path: "/api/admin/purge-video", Handler: mediaHandler.PurgeVideo, Access: middleware.Curator},
+		{Path: "/api/admin/backup", Handler: backupHandler.DownloadBackup, Access: middleware.Admin},
+		{Path: "/api/admin/restore", Handler: backupHandler.RestoreBackup, Access: middleware.Admin},
+		{Path: "/api/admin/users", Handler: usersHandler.Users, Access: middleware.Admin},
+		{Path: "/api/admin/channel-owner", Handler: usersHandler.ChannelOwner, Access: middleware.Admin},
+	}
+	if mediaLibraryPath != "" {
+		libraryHandler := handlers.NewLibraryHandler(mediaLibraryPath)
+		routes = append(routes, Route{Path: library.URLPrefix, Handler: libraryHandler.ServeMedia, Access: middleware.Public})
+	}
+
+	// The health endpoints are served during startup too, reporting the
+	// server as not ready until the channel list has been imported, while
+	// every other route is unavailable until then
+	for i := range routes {
+		routes[i].Handler = healthHandler.AfterStartup(routes[i].Handler)
+	}
+	routes = append(routes,
+		Route{Path: "/healthz", Handler: healthHandler.Live, Access: middleware.Public},
+		Route{Path: "/readyz", Handler: healthHandler.Ready, Access: middleware.Public},
+		Route{Path: "/metrics", Handler: metrics.Handler().ServeHTTP, Access: middleware.Public},
+	)
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, routes, cfg.ReadonlyMode)
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           middleware.RequestID(middleware.Timeout(cfg.RequestTimeout, middleware.Authenticate(authService, mux))),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	logger.Info("Server starting", "port", cfg.Port)
+
+	if err := mediaService.SyncFromFile(ctx, cfg.JSONFilePath, cfg.SyncMode); err != nil {
+		fatal("Failed to sync channel list", err)
+	}
+
+	if libraryService != nil {
+		if err := libraryService.Sync(ctx); err != nil {
+			logger.Error("Failed to sync media library", "error", err)
+			healthHandler.AddCheck("media_library", func(ctx context.Context) error {
+				return fmt.Errorf("failed to sync media library: %w", err)
+			})
+		}
+	}
+
+	// Background workers stop when ctx is canceled, and are waited for
+	// before the database is closed
+	var workers sync.WaitGroup
+
+	if backupService.Dir != "" && cfg.BackupInterval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			backupService.Schedule(ctx, cfg.BackupInterval)
+		}()
+		healthHandler.AddCheck("backups", func(ctx context.Context) error {
+			return backupService.CheckSchedule()
+		})
+	}
+
+	healthHandler.SetStarted()
+
+	select {
+	case err = <-serverErr:
+	case <-ctx.Done():
+	}
+
+	// Stops the background workers, and lets a second signal kill the
+	// process without waiting
+	stop()
+	if err == nil {
+		shutdown(server, healthHandler, cfg.ShutdownDelay, cfg.ShutdownTimeout)
+	}
+	workers.Wait()
+	db.CloseConnector()
+
+	if err != nil {
+		fatal("Server failed", err)
+	}
+	logger.Info("Server stopped")
+}
+
+// shutdown reports the server as not ready, keeps serving for delay and then
+// waits up to timeout for open requests, such as a list being imported, to
+// finish before closing the remaining connections.
+func shutdown(server *http.Server, health *handlers.Health, delay time.Duration, timeout time.Duration) {
+	slog.Info("Shutting down")
+	health.SetStopping()
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Warn("Open requests did not finish in time", "error", err)
+		server.Close()
+	}
+}
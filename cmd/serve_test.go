@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/middleware"
+)
+
+func TestRegisterRoutesReadonly(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	routes := []Route{
+		{Path: "/public", Handler: ok, Access: middleware.Public},
+		{Path: "/public-write", Handler: ok, Access: middleware.PublicWrite},
+		{Path: "/curator", Handler: ok, Access: middleware.Curator},
+		{Path: "/admin", Handler: ok, Access: middleware.Admin},
+	}
+
+	tests := []struct {
+		name     string
+		readonly bool
+		method   string
+		path     string
+		want     int
+	}{
+		{name: "public change", readonly: true, method: http.MethodPost, path: "/public", want: http.StatusOK},
+		{name: "visitor change", readonly: true, method: http.MethodPost, path: "/public-write", want: http.StatusServiceUnavailable},
+		{name: "curator change", readonly: true, method: http.MethodPut, path: "/curator", want: http.StatusServiceUnavailable},
+		{name: "admin change", readonly: true, method: http.MethodPost, path: "/admin", want: http.StatusServiceUnavailable},
+		{name: "admin delete", readonly: true, method: http.MethodDelete, path: "/admin", want: http.StatusServiceUnavailable},
+		{name: "admin read", readonly: true, method: http.MethodGet, path: "/admin", want: http.StatusOK},
+		{name: "curator read", readonly: true, method: http.MethodGet, path: "/curator", want: http.StatusOK},
+		{name: "admin change when writable", method: http.MethodPost, path: "/admin", want: http.StatusOK},
+		{name: "visitor change when writable", method: http.MethodPost, path: "/public-write", want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			registerRoutes(mux, routes, test.readonly)
+
+			request := httptest.NewRequest(test.method, test.path, nil)
+			request = request.WithContext(auth.WithIdentity(context.Background(), auth.CommandLine))
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.want {
+				t.Errorf("got status %d, want %d", recorder.Code, test.want)
+			}
+		})
+	}
+}
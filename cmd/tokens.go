@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ozencb/couchtube/db"
+)
+
+const tokensUsage = `Usage: couchtube tokens <command>
+
+Commands:
+  create <name>        Create an admin API token and print it
+  list                 List tokens with when they were last used
+  revoke <name|id>     Delete a token
+
+Tokens are sent as "Authorization: Bearer <token>". Only a hash is stored,
+so a token is shown once, when it is created.`
+
+func runTokens(args []string) {
+	flags := newFlagSet("tokens", tokensUsage)
+	cfg := loadConfig(flags, args)
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	dbInstance := openDatabase(cfg)
+	defer db.CloseConnector()
+	authService := newAuthService(dbInstance, cfg, nil)
+
+	switch {
+	case args[0] == "create" && len(args) == 2:
+		token, err := authService.CreateToken(ctx, args[1])
+		if err != nil {
+			fatal("Failed to create token", err)
+		}
+		fmt.Println(token)
+	case args[0] == "list" && len(args) == 1:
+		tokens, err := authService.ListTokens(ctx)
+		if err != nil {
+			fatal("Failed to list tokens", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCREATED\tLAST USED")
+		for _, token := range tokens {
+			lastUsed := "never"
+			if token.LastUsedAt != nil {
+				lastUsed = time.Unix(*token.LastUsedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", token.ID, token.Name, time.Unix(token.CreatedAt, 0).Format(time.RFC3339), lastUsed)
+		}
+		w.Flush()
+	case args[0] == "revoke" && len(args) == 2:
+		if err := authService.RevokeToken(ctx, args[1]); err != nil {
+			fatal("Failed to revoke token", err)
+		}
+		slog.Info("Token revoked", "token", args[1])
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
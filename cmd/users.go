@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ozencb/couchtube/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+const usersUsage = `Usage: couchtube users <command>
+
+Commands:
+  add <name> [role]         Add a user, a viewer unless role says otherwise
+  list                      List users with their roles
+  set-role <name> <role>    Change the role of a user
+  passwd <name>             Set the password of a user, read from stdin
+  set-rating <name> <max>   Limit a user to content rated up to max, or none
+  pin <name>                Lock a user with a PIN read from stdin, or unlock
+                            them when it is empty
+  remove <name>             Delete a user, ending their sessions
+
+Roles are viewer, curator and admin. Curators may edit the channels they
+own and triage reported videos. Users signing in with OpenID Connect are
+added on their first sign-in, and get the role their claims map to.
+
+Viewers with a max rating or a PIN are profiles, which anyone can switch to
+on the TV without a password, giving the PIN if there is one. Ratings are
+G, PG, PG-13, R, NC-17 or an age.`
+
+func runUsers(args []string) {
+	flags := newFlagSet("users", usersUsage)
+	cfg := loadConfig(flags, args)
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	dbInstance := openDatabase(cfg)
+	defer db.CloseConnector()
+	authService := newAuthService(dbInstance, cfg, nil)
+
+	switch {
+	case args[0] == "add" && (len(args) == 2 || len(args) == 3):
+		role := "viewer"
+		if len(args) == 3 {
+			role = args[2]
+		}
+		if _, err := authService.FindUser(ctx, args[1]); err == nil {
+			fatal("Failed to add user", fmt.Errorf("user %s already exists", args[1]))
+		}
+		if _, err := authService.SaveUser(ctx, jsonmodels.UserRequestJson{Name: args[1], Role: role}); err != nil {
+			fatal("Failed to add user", err)
+		}
+		slog.Info("User added", "user", args[1], "role", role)
+	case args[0] == "list" && len(args) == 1:
+		users, err := authService.ListUsers(ctx)
+		if err != nil {
+			fatal("Failed to list users", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tROLE\tPASSWORD\tMAX RATING\tPIN\tCREATED")
+		for _, user := range users {
+			password, pin := "no", "no"
+			if user.PasswordHash != "" {
+				password = "yes"
+			}
+			if user.PinHash != "" {
+				pin = "yes"
+			}
+			maxRating := user.MaxRating
+			if maxRating == "" {
+				maxRating = "none"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", user.ID, user.Name, user.Role, password, maxRating, pin, time.Unix(user.CreatedAt, 0).Format(time.RFC3339))
+		}
+		w.Flush()
+	case args[0] == "set-role" && len(args) == 3:
+		if _, err := authService.FindUser(ctx, args[1]); err != nil {
+			fatal("Failed to set role", err)
+		}
+		if _, err := authService.SaveUser(ctx, jsonmodels.UserRequestJson{Name: args[1], Role: args[2]}); err != nil {
+			fatal("Failed to set role", err)
+		}
+		slog.Info("Role set", "user", args[1], "role", args[2])
+	case args[0] == "passwd" && len(args) == 2:
+		if _, err := authService.FindUser(ctx, args[1]); err != nil {
+			fatal("Failed to set password", err)
+		}
+
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		if password == "" {
+			fatal("Failed to set password", fmt.Errorf("no password given: %v", err))
+		}
+
+		if _, err := authService.SaveUser(ctx, jsonmodels.UserRequestJson{Name: args[1], Password: password}); err != nil {
+			fatal("Failed to set password", err)
+		}
+		slog.Info("Password set", "user", args[1])
+	case args[0] == "set-rating" && len(args) == 3:
+		rating := args[2]
+		if rating == "none" {
+			rating = ""
+		}
+		if err := authService.SetMaxRating(ctx, args[1], rating); err != nil {
+			fatal("Failed to set max rating", err)
+		}
+		slog.Info("Max rating set", "user", args[1], "max_rating", args[2])
+	case args[0] == "pin" && len(args) == 2:
+		if _, err := authService.FindUser(ctx, args[1]); err != nil {
+			fatal("Failed to set PIN", err)
+		}
+
+		fmt.Fprint(os.Stderr, "PIN (empty to remove): ")
+		pin, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		pin = strings.TrimRight(pin, "\r\n")
+
+		if err := authService.SetPIN(ctx, args[1], pin); err != nil {
+			fatal("Failed to set PIN", err)
+		}
+		if pin == "" {
+			slog.Info("PIN removed", "user", args[1])
+		} else {
+			slog.Info("PIN set", "user", args[1])
+		}
+	case args[0] == "remove" && len(args) == 2:
+		if err := authService.DeleteUser(ctx, args[1]); err != nil {
+			fatal("Failed to remove user", err)
+		}
+		slog.Info("User removed", "user", args[1])
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
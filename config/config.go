@@ -0,0 +1,429 @@
+// Package config loads CouchTube's settings. Each setting is looked up in
+// layers, each overriding the one before: built-in defaults, a YAML or TOML
+// config file, environment variables and command line flags.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"github.com/ozencb/couchtube/helpers"
+	"gopkg.in/yaml.v3"
+)
+
+// Where the value of a setting came from.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// defaultFiles are looked for in the working directory when no config file
+// is given.
+var defaultFiles = []string{"couchtube.yaml", "couchtube.yml", "couchtube.toml"}
+
+type Config struct {
+	Port string
+	// ShutdownDelay is how long the server keeps serving, while reporting
+	// itself not ready, after it is asked to stop. It gives load balancers
+	// time to stop sending it requests.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is how long open requests then get to finish.
+	ShutdownTimeout time.Duration
+	// RequestTimeout limits how long an API request may take, including
+	// its database queries. Media files are streamed without a limit.
+	RequestTimeout time.Duration
+	// FetchTimeout limits downloading a channel list submitted by URL.
+	FetchTimeout time.Duration
+	// DatabaseURL selects the database driver by its scheme, either
+	// postgres:// or sqlite://. An empty URL means the SQLite file at
+	// DatabaseFilePath.
+	DatabaseURL      string
+	DatabaseFilePath string
+	JSONFilePath     string
+	// SyncMode decides how the channel list in JSONFilePath is applied on
+	// startup: "initial" only fills an empty database, "reconcile" applies
+	// the differences and "wipe" deletes everything and reloads the file.
+	SyncMode string
+	// FullScan predates SyncMode, and means "reconcile" when SyncMode is
+	// not set.
+	FullScan     bool
+	ReadonlyMode bool
+	// DefaultMaxRating is the highest content rating shown to visitors who
+	// aren't signed in and to users without a max rating of their own, or
+	// empty for no limit.
+	DefaultMaxRating string
+
+	// AdminPassword enables signing in to the web UI as an admin. Without
+	// it, admin endpoints can only be used with API tokens.
+	AdminPassword string
+	SessionTTL    time.Duration
+
+	// OIDCDiscoveryURL enables signing in with an OpenID Connect provider.
+	// Users are admins or curators when OIDCRoleClaim in their ID token
+	// holds one of the comma separated OIDCAdminRoles or OIDCCuratorRoles,
+	// and viewers otherwise.
+	OIDCDiscoveryURL string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       string
+	OIDCRoleClaim    string
+	OIDCAdminRoles   string
+	OIDCCuratorRoles string
+
+	// InvalidationThreshold is the number of distinct clients that must
+	// report a video within InvalidationWindow before it is quarantined.
+	InvalidationThreshold int
+	InvalidationWindow    time.Duration
+	// ClientIPHeader names a header set by a trusted reverse proxy that
+	// carries the original client IP, such as X-Forwarded-For. It is only
+	// read from requests sent by one of TrustedProxies.
+	ClientIPHeader string
+	TrustedProxies []netip.Prefix
+
+	// MediaLibraryPath is the directory whose subfolders are turned into
+	// channels. Local media is disabled when it is empty.
+	MediaLibraryPath string
+	MediaProber      string
+
+	// BackupDir is where scheduled backups are written. Scheduled backups
+	// are disabled when it is empty.
+	BackupDir       string
+	BackupInterval  time.Duration
+	BackupRetention int
+	// MaxRestoreSize is the largest backup, in megabytes, that can be
+	// uploaded to be restored.
+	MaxRestoreSize int
+
+	LogLevel  string
+	LogFormat string
+
+	// File is the config file that was read, if any.
+	File string
+
+	values  map[string]string
+	sources map[string]string
+}
+
+type setting struct {
+	key   string
+	value string
+	usage string
+	apply func(c *Config, value string) error
+}
+
+// settings lists every setting with its default. The key is used as is in
+// config files, upper cased for environment variables and with dashes for
+// flags, e.g. database_url, DATABASE_URL and -database-url.
+var settings = []setting{
+	{"port", "8363", "port to listen on", stringSetting(func(c *Config) *string { return &c.Port })},
+	{"shutdown_delay", "0s", "time to keep serving, reported as not ready, before shutting down", durationSetting(func(c *Config) *time.Duration { return &c.ShutdownDelay })},
+	{"shutdown_timeout", "30s", "time given to open requests to finish on shutdown", durationSetting(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+	{"request_timeout", "30s", "time an API request may take before it is canceled", durationSetting(func(c *Config) *time.Duration { return &c.RequestTimeout })},
+	{"fetch_timeout", "15s", "time given to download a submitted channel list", durationSetting(func(c *Config) *time.Duration { return &c.FetchTimeout })},
+	{"database_url", "", "database to use, e.g. postgres://host/couchtube or sqlite://couchtube.db", stringSetting(func(c *Config) *string { return &c.DatabaseURL })},
+	{"database_file_path", "couchtube.db", "SQLite database file used when database_url is not set", stringSetting(func(c *Config) *string { return &c.DatabaseFilePath })},
+	{"json_file_path", "/videos.json", "channel list applied on startup", stringSetting(func(c *Config) *string { return &c.JSONFilePath })},
+	{"sync_mode", "", "how the channel list is applied on startup: initial, reconcile or wipe", stringSetting(func(c *Config) *string { return &c.SyncMode })},
+	{"full_scan", "false", "deprecated; reconcile the channel list when sync_mode is not set", boolSetting(func(c *Config) *bool { return &c.FullScan })},
+	{"readonly_mode", "false", "reject every change, by visitors, curators and admins alike", boolSetting(func(c *Config) *bool { return &c.ReadonlyMode })},
+	{"default_max_rating", "", "highest content rating shown to visitors who aren't signed in and to users without one of their own, e.g. PG or 12; no limit when empty", ratingSetting(func(c *Config) *string { return &c.DefaultMaxRating })},
+	{"admin_password", "", "password for signing in to the web UI as an admin; sign-in is disabled when empty", stringSetting(func(c *Config) *string { return &c.AdminPassword })},
+	{"session_ttl", "168h", "time a web UI sign-in lasts", durationSetting(func(c *Config) *time.Duration { return &c.SessionTTL })},
+	{"oidc_discovery_url", "", "OpenID Connect provider to sign in with, e.g. https://auth.example.org; disabled when empty", stringSetting(func(c *Config) *string { return &c.OIDCDiscoveryURL })},
+	{"oidc_client_id", "", "client ID registered with the OpenID Connect provider", stringSetting(func(c *Config) *string { return &c.OIDCClientID })},
+	{"oidc_client_secret", "", "client secret registered with the OpenID Connect provider", stringSetting(func(c *Config) *string { return &c.OIDCClientSecret })},
+	{"oidc_redirect_url", "", "URL of /api/oidc/callback as reached by browsers", stringSetting(func(c *Config) *string { return &c.OIDCRedirectURL })},
+	{"oidc_scopes", "openid profile email groups", "scopes requested from the OpenID Connect provider", stringSetting(func(c *Config) *string { return &c.OIDCScopes })},
+	{"oidc_role_claim", "groups", "ID token claim mapped to roles", stringSetting(func(c *Config) *string { return &c.OIDCRoleClaim })},
+	{"oidc_admin_roles", "couchtube-admins", "comma separated values of the role claim that make a user an admin", stringSetting(func(c *Config) *string { return &c.OIDCAdminRoles })},
+	{"oidc_curator_roles", "couchtube-curators", "comma separated values of the role claim that make a user a curator", stringSetting(func(c *Config) *string { return &c.OIDCCuratorRoles })},
+	{"invalidation_threshold", "3", "distinct clients that must report a video before it is quarantined", intSetting(func(c *Config) *int { return &c.InvalidationThreshold })},
+	{"invalidation_window", "24h", "time window in which those reports must arrive", durationSetting(func(c *Config) *time.Duration { return &c.InvalidationWindow })},
+	{"client_ip_header", "", "header carrying the client IP behind a trusted proxy", stringSetting(func(c *Config) *string { return &c.ClientIPHeader })},
+	{"trusted_proxies", "", "comma separated IP addresses or CIDR ranges of the proxies client_ip_header is read from", networksSetting(func(c *Config) *[]netip.Prefix { return &c.TrustedProxies })},
+	{"media_library_path", "", "directory of local video files to build channels from", stringSetting(func(c *Config) *string { return &c.MediaLibraryPath })},
+	{"media_prober", "metadata", "how durations of local files are read: metadata or ffprobe", stringSetting(func(c *Config) *string { return &c.MediaProber })},
+	{"backup_dir", "", "directory for scheduled database backups", stringSetting(func(c *Config) *string { return &c.BackupDir })},
+	{"backup_interval", "24h", "time between scheduled backups", durationSetting(func(c *Config) *time.Duration { return &c.BackupInterval })},
+	{"backup_retention", "7", "number of backups kept in backup_dir", intSetting(func(c *Config) *int { return &c.BackupRetention })},
+	{"max_restore_size_mb", "1024", "largest backup in megabytes that can be uploaded to be restored", intSetting(func(c *Config) *int { return &c.MaxRestoreSize })},
+	{"log_level", "info", "least severe log level written: debug, info, warn or error", stringSetting(func(c *Config) *string { return &c.LogLevel })},
+	{"log_format", "text", "format of log lines: text or json", stringSetting(func(c *Config) *string { return &c.LogFormat })},
+}
+
+// Loader reads the configuration once its flags have been parsed.
+type Loader struct {
+	flags      *flag.FlagSet
+	configFile *string
+	values     map[string]*settingFlag
+}
+
+// NewLoader adds a flag for every setting, and one for the config file, to
+// flags.
+func NewLoader(flags *flag.FlagSet) *Loader {
+	l := &Loader{
+		flags:      flags,
+		configFile: flags.String("config", "", "YAML or TOML config file (default couchtube.yaml, .yml or .toml if present)"),
+		values:     make(map[string]*settingFlag, len(settings)),
+	}
+
+	for _, s := range settings {
+		// Settings defaulting to a boolean are switches
+		value := &settingFlag{isBool: s.value == "false" || s.value == "true"}
+		l.values[s.key] = value
+		flags.Var(value, flagName(s.key), fmt.Sprintf("%s (default %q)", s.usage, s.value))
+	}
+
+	return l
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the flags that were set, in that order.
+func (l *Loader) Load() (*Config, error) {
+	// Variables from a .env file count as environment variables
+	godotenv.Load()
+
+	c := &Config{
+		values:  make(map[string]string, len(settings)),
+		sources: make(map[string]string, len(settings)),
+	}
+	for _, s := range settings {
+		c.values[s.key] = s.value
+		c.sources[s.key] = SourceDefault
+	}
+
+	file, err := l.findFile()
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		values, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			if _, known := c.values[key]; !known {
+				return nil, fmt.Errorf("unknown setting %q in %s", key, file)
+			}
+			c.values[key] = value
+			c.sources[key] = SourceFile
+		}
+		c.File = file
+	}
+
+	for _, s := range settings {
+		if value, exists := os.LookupEnv(strings.ToUpper(s.key)); exists {
+			c.values[s.key] = value
+			c.sources[s.key] = SourceEnv
+		}
+	}
+
+	l.flags.Visit(func(f *flag.Flag) {
+		key := strings.ReplaceAll(f.Name, "-", "_")
+		if value, ok := l.values[key]; ok {
+			c.values[key] = value.value
+			c.sources[key] = SourceFlag
+		}
+	})
+
+	for _, s := range settings {
+		if err := s.apply(c, c.values[s.key]); err != nil {
+			return nil, fmt.Errorf("invalid %s from %s: %w", s.key, c.sources[s.key], err)
+		}
+	}
+
+	if c.SyncMode == "" {
+		c.SyncMode = "initial"
+		if c.FullScan {
+			c.SyncMode = "reconcile"
+			c.sources["sync_mode"] = c.sources["full_scan"] + " (full_scan)"
+		}
+		c.values["sync_mode"] = c.SyncMode
+	}
+
+	return c, nil
+}
+
+// findFile returns the config file named by -config or COUCHTUBE_CONFIG, or
+// the first default file that exists.
+func (l *Loader) findFile() (string, error) {
+	if *l.configFile != "" {
+		return *l.configFile, nil
+	}
+	if file := os.Getenv("COUCHTUBE_CONFIG"); file != "" {
+		return file, nil
+	}
+
+	for _, file := range defaultFiles {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// readFile reads a flat YAML or TOML file of settings, picking the format by
+// the file extension.
+func readFile(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q, use .yaml, .yml or .toml", filepath.Ext(file))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("setting %q in %s must be a single value", key, file)
+		}
+		values[key] = fmt.Sprint(value)
+	}
+
+	return values, nil
+}
+
+// Setting is the effective value of a setting and where it came from.
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// Settings lists every setting in order, with secrets and the password in
+// the database URL masked.
+func (c *Config) Settings() []Setting {
+	list := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		value := c.values[s.key]
+		switch {
+		case s.key == "database_url":
+			value = maskPassword(value)
+		case (s.key == "admin_password" || s.key == "oidc_client_secret") && value != "":
+			value = "xxxxx"
+		}
+		list = append(list, Setting{Key: s.key, Value: value, Source: c.sources[s.key]})
+	}
+
+	return list
+}
+
+func maskPassword(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.User == nil {
+		return value
+	}
+	if _, hasPassword := parsed.User.Password(); hasPassword {
+		parsed.User = url.UserPassword(parsed.User.Username(), "xxxxx")
+	}
+	return parsed.String()
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// settingFlag holds the raw value of a setting's flag. It is parsed along
+// with the other layers, so flags don't need their own types.
+type settingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *settingFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be passed as a bare -flag.
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func stringSetting(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func boolSetting(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		*field(c) = parsed
+		return err
+	}
+}
+
+func intSetting(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		*field(c) = parsed
+		return err
+	}
+}
+
+func ratingSetting(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		if value == "" {
+			*field(c) = ""
+			return nil
+		}
+		rating, ok := helpers.NormalizeRating(value)
+		if !ok {
+			return fmt.Errorf("unknown content rating %q", value)
+		}
+		*field(c) = rating
+		return nil
+	}
+}
+
+func networksSetting(field func(*Config) *[]netip.Prefix) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		networks, err := helpers.ParseNetworks(value)
+		*field(c) = networks
+		return err
+	}
+}
+
+func durationSetting(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		*field(c) = parsed
+		return err
+	}
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ozencb/couchtube/db/dialect"
+	"github.com/ozencb/couchtube/db/migrations"
+)
+
+// ErrBackupUnsupported is returned when the database is not SQLite.
+// PostgreSQL servers have their own tooling for this, such as pg_dump.
+var ErrBackupUnsupported = errors.New("backups are only supported for SQLite databases")
+
+// ErrInvalidBackup is returned when a file handed to RestoreSnapshot can't
+// be restored by this build.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// backupTables lists the tables holding data, parents before children.
+// API tokens and sessions are left alone, so restoring an old snapshot
+// doesn't bring back revoked tokens. Sessions of users end with the users
+// being replaced, but admin password sign-ins are kept.
+var backupTables = []string{"users", "channels", "videos", "channel_videos", "video_reports", "lineup_preferences"}
+
+// Snapshot writes a consistent copy of the database to dest. It can be taken
+// while the server is running.
+func Snapshot(ctx context.Context, db *sql.DB, dest string) error {
+	if GetDialect() != dialect.SQLite {
+		return ErrBackupUnsupported
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	_, err := db.ExecContext(ctx, `VACUUM INTO ?`, dest)
+	return err
+}
+
+// RestoreSnapshot replaces all data in the database with the data in the
+// snapshot at src. Snapshots taken by older versions are migrated first, on
+// a copy so the file itself is left alone.
+func RestoreSnapshot(ctx context.Context, db *sql.DB, src string) error {
+	if GetDialect() != dialect.SQLite {
+		return ErrBackupUnsupported
+	}
+
+	copyPath, err := copyToTemp(src)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(copyPath)
+
+	if err := prepareSnapshot(copyPath); err != nil {
+		return err
+	}
+
+	// ATTACH is per connection and can't run inside a transaction, so pin
+	// one connection for the whole restore
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS snapshot`, copyPath); err != nil {
+		return err
+	}
+	// Detached even if ctx is canceled, since the connection goes back to
+	// the pool
+	defer conn.ExecContext(context.Background(), `DETACH DATABASE snapshot`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := copySnapshotTables(ctx, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func copySnapshotTables(ctx context.Context, tx *sql.Tx) error {
+	for i := len(backupTables) - 1; i >= 0; i-- {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM main.%s`, backupTables[i])); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range backupTables {
+		columns, err := tableColumns(ctx, tx, table)
+		if err != nil {
+			return err
+		}
+
+		// Columns are listed by name since upgraded databases may have them
+		// in a different order than fresh ones
+		list := strings.Join(columns, ", ")
+		query := fmt.Sprintf(`INSERT INTO main.%s (%s) SELECT %s FROM snapshot.%s`, table, list, list, table)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`PRAGMA main.table_info(%s)`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return nil, err
+		}
+		columns = append(columns, `"`+name+`"`)
+	}
+
+	return columns, rows.Err()
+}
+
+// prepareSnapshot checks that the file at path is a CouchTube database no
+// newer than this build, and brings its schema up to date.
+func prepareSnapshot(path string) error {
+	snapshot, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	isCouchTube, err := hasTable(snapshot, "schema_migrations")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if !isCouchTube {
+		return fmt.Errorf("%w: not a CouchTube database", ErrInvalidBackup)
+	}
+
+	migrator, err := migrations.NewMigrator(snapshot, dialect.SQLite)
+	if err != nil {
+		return err
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	var snapshotVersion int
+	if err := snapshot.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&snapshotVersion); err != nil {
+		return err
+	}
+	if len(statuses) > 0 && snapshotVersion > statuses[len(statuses)-1].Version {
+		return fmt.Errorf("%w: schema version %d is newer than this build supports", ErrInvalidBackup, snapshotVersion)
+	}
+
+	_, err = migrator.Up()
+	return err
+}
+
+func copyToTemp(src string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp("", "couchtube-restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+
+	return out.Name(), nil
+}
@@ -3,70 +3,106 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
 	"sync"
 
+	_ "github.com/lib/pq"
 	"github.com/ozencb/couchtube/config"
+	"github.com/ozencb/couchtube/db/dialect"
 	_ "modernc.org/sqlite"
 )
 
 var (
 	dbInstance *sql.DB
+	dbDialect  dialect.Dialect
 	once       sync.Once
 	closeOnce  sync.Once
 )
 
-func GetDbConnection() (*sql.DB, error) {
+// GetDbConnection opens the database described by cfg.DatabaseURL, falling
+// back to the SQLite file at cfg.DatabaseFilePath when it is not set.
+func GetDbConnection(cfg *config.Config) (*sql.DB, error) {
 	var err error
 	once.Do(func() {
-		dbFilePath := config.GetDBFilePath()
+		databaseURL := cfg.DatabaseURL
 
-		// Create the database file if it doesn't exist
-		if _, err = os.Stat(dbFilePath); os.IsNotExist(err) {
-			var file *os.File
-			file, err = os.Create(dbFilePath)
-			if err != nil {
-				log.Fatalf("Failed to create database file: %v", err)
-			}
-			file.Close()
-			log.Printf("Created new SQLite database file at %s", dbFilePath)
+		switch {
+		case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"):
+			dbInstance, err = openPostgres(databaseURL)
+		case strings.HasPrefix(databaseURL, "sqlite://"):
+			dbInstance, err = openSQLite(strings.TrimPrefix(databaseURL, "sqlite://"))
+		case databaseURL == "":
+			dbInstance, err = openSQLite(cfg.DatabaseFilePath)
+		default:
+			err = fmt.Errorf("unsupported DATABASE_URL scheme in %q", databaseURL)
 		}
-
-		// Open the database
-		dsn := fmt.Sprintf("file:%s?cache=shared", dbFilePath)
-		dbInstance, err = sql.Open("sqlite", dsn)
 		if err != nil {
-			log.Fatalf("Failed to open database: %v", err)
-		}
-
-		// Enable foreign key constraints
-		if _, err = dbInstance.Exec("PRAGMA foreign_keys = ON;"); err != nil {
-			log.Fatalf("Failed to enable foreign keys: %v", err)
+			err = fmt.Errorf("failed to open database: %w", err)
+			return
 		}
 
 		// Test the database connection
 		if err = dbInstance.Ping(); err != nil {
 			dbInstance.Close()
-			log.Fatalf("Failed to ping database: %v", err)
+			err = fmt.Errorf("failed to ping database: %w", err)
 		}
 	})
 
 	if err != nil {
-		log.Printf("Failed to get database connector: %v", err)
 		return nil, err
 	}
 
 	return dbInstance, err
 }
 
+// GetDialect returns the dialect of the database opened by GetDbConnection.
+func GetDialect() dialect.Dialect {
+	return dbDialect
+}
+
+func openSQLite(dbFilePath string) (*sql.DB, error) {
+	// Create the database file if it doesn't exist
+	if _, err := os.Stat(dbFilePath); os.IsNotExist(err) {
+		file, err := os.Create(dbFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create database file: %w", err)
+		}
+		file.Close()
+		slog.Info("Created new SQLite database file", "path", dbFilePath)
+	}
+
+	// Open the database, enabling foreign key constraints on every
+	// pooled connection rather than just the first one
+	dsn := fmt.Sprintf("file:%s?cache=shared&_pragma=foreign_keys(1)", dbFilePath)
+	database, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	dbDialect = dialect.SQLite
+	return database, nil
+}
+
+func openPostgres(databaseURL string) (*sql.DB, error) {
+	database, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Using PostgreSQL database")
+	dbDialect = dialect.Postgres
+	return database, nil
+}
+
 func CloseConnector() {
 	closeOnce.Do(func() {
 		if dbInstance != nil {
 			if err := dbInstance.Close(); err != nil {
-				log.Printf("Error closing the database connection: %v", err)
+				slog.Error("Error closing the database connection", "error", err)
 			} else {
-				log.Println("Database connection closed successfully.")
+				slog.Info("Database connection closed successfully.")
 			}
 			dbInstance = nil // Ensure we don't try to close it again
 		}
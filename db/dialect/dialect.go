@@ -0,0 +1,43 @@
+package dialect
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour spoken by the database behind a
+// connection. Queries are written with SQLite style ? placeholders and
+// rebound for the database they run on.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// Rebind rewrites ? placeholders into the form the dialect expects.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	inString := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
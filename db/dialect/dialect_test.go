@@ -0,0 +1,57 @@
+package dialect
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{
+			name:    "sqlite keeps placeholders",
+			dialect: SQLite,
+			query:   `SELECT id FROM channels WHERE name = ? AND profile_id = ?`,
+			want:    `SELECT id FROM channels WHERE name = ? AND profile_id = ?`,
+		},
+		{
+			name:    "postgres numbers placeholders",
+			dialect: Postgres,
+			query:   `INSERT INTO users (name, role) VALUES (?, ?) RETURNING id`,
+			want:    `INSERT INTO users (name, role) VALUES ($1, $2) RETURNING id`,
+		},
+		{
+			name:    "postgres leaves question marks in strings alone",
+			dialect: Postgres,
+			query:   `SELECT id FROM videos WHERE url = 'https://example.org/?v=1' AND id = ?`,
+			want:    `SELECT id FROM videos WHERE url = 'https://example.org/?v=1' AND id = $1`,
+		},
+		{
+			name:    "postgres handles placeholders inside NULLIF",
+			dialect: Postgres,
+			query:   `UPDATE users SET pin_hash = NULLIF(?, '') WHERE id = ?`,
+			want:    `UPDATE users SET pin_hash = NULLIF($1, '') WHERE id = $2`,
+		},
+		{
+			name:    "postgres without placeholders",
+			dialect: Postgres,
+			query:   `SELECT COUNT(*) FROM channels`,
+			want:    `SELECT COUNT(*) FROM channels`,
+		},
+		{
+			name:    "postgres with multibyte characters",
+			dialect: Postgres,
+			query:   `SELECT 'café ?' WHERE name = ?`,
+			want:    `SELECT 'café ?' WHERE name = $1`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.dialect.Rebind(test.query); got != test.want {
+				t.Errorf("Rebind(%q) = %q, want %q", test.query, got, test.want)
+			}
+		})
+	}
+}
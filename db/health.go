@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ozencb/couchtube/db/migrations"
+)
+
+// Ping checks that the database answers queries. It reads from a table
+// rather than only opening a connection, so a locked or corrupt database
+// file fails it too.
+func Ping(ctx context.Context, db *sql.DB) error {
+	var exists int
+	err := db.QueryRowContext(ctx, `SELECT 1 FROM channels LIMIT 1`).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// CheckMigrations returns an error if any migration known to this build is
+// not applied.
+func CheckMigrations(db *sql.DB) error {
+	migrator, err := migrations.NewMigrator(db, GetDialect())
+	if err != nil {
+		return err
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d migrations pending", pending)
+	}
+
+	return nil
+}
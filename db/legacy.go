@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// upgradeLegacySchema brings SQLite databases created before versioned
+// migrations existed up to the schema of the initial migration, which then
+// only fills in missing tables and gets recorded as applied.
+func upgradeLegacySchema(db *sql.DB) error {
+	versioned, err := hasTable(db, "schema_migrations")
+	if err != nil || versioned {
+		return err
+	}
+	legacy, err := hasTable(db, "videos")
+	if err != nil || !legacy {
+		return err
+	}
+
+	slog.Info("Upgrading database created before schema migrations.")
+	return upgradeTables(db)
+}
+
+// upgradeTables adds the columns introduced before versioned migrations
+// existed, then moves video sections onto channel entries.
+func upgradeTables(db *sql.DB) error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"videos", "status", `TEXT NOT NULL DEFAULT 'active'`},
+		{"videos", "report_count", `INTEGER NOT NULL DEFAULT 0`},
+		{"videos", "last_reported_at", `INTEGER`},
+		{"videos", "source", `TEXT NOT NULL DEFAULT 'youtube'`},
+		{"videos", "url", `TEXT`},
+		{"channels", "source", `TEXT NOT NULL DEFAULT 'list'`},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	return moveSectionsToChannelVideos(db)
+}
+
+// moveSectionsToChannelVideos rebuilds the videos and channel_videos tables of
+// databases created when a video could only have a single section, copying
+// each video's section onto the channel entries that reference it.
+func moveSectionsToChannelVideos(db *sql.DB) error {
+	legacy, err := hasColumn(db, "videos", "section_start")
+	if err != nil || !legacy {
+		return err
+	}
+
+	// Foreign keys have to be disabled outside of a transaction while the
+	// tables are swapped, so pin a single connection for the whole rebuild.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF;`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON;`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`CREATE TABLE channel_videos_new (
+		"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"channel_id" INTEGER NOT NULL,
+		"video_id" TEXT NOT NULL,
+		"position" INTEGER NOT NULL,
+		"section_start" INTEGER NOT NULL,
+		"section_end" INTEGER NOT NULL,
+		FOREIGN KEY(channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+		FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+		CHECK (section_end > section_start)
+	);`,
+		`INSERT INTO channel_videos_new (channel_id, video_id, position, section_start, section_end)
+		SELECT channel_videos.channel_id, channel_videos.video_id,
+			ROW_NUMBER() OVER (PARTITION BY channel_videos.channel_id ORDER BY channel_videos.rowid) - 1,
+			videos.section_start, videos.section_end
+		FROM channel_videos
+		JOIN videos ON videos.id = channel_videos.video_id;`,
+		`CREATE TABLE videos_new (
+		"id" TEXT NOT NULL PRIMARY KEY,
+		"source" TEXT NOT NULL DEFAULT 'youtube',
+		"url" TEXT,
+		"status" TEXT NOT NULL DEFAULT 'active',
+		"report_count" INTEGER NOT NULL DEFAULT 0,
+		"last_reported_at" INTEGER
+	);`,
+		`INSERT INTO videos_new (id, source, url, status, report_count, last_reported_at)
+		SELECT id, source, url, status, report_count, last_reported_at FROM videos;`,
+		`DROP TABLE channel_videos;`,
+		`DROP TABLE videos;`,
+		`ALTER TABLE videos_new RENAME TO videos;`,
+		`ALTER TABLE channel_videos_new RENAME TO channel_videos;`,
+		`CREATE INDEX IF NOT EXISTS idx_videos_channel_id ON channel_videos(channel_id, video_id);`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	var violations int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_foreign_key_check;`).Scan(&violations); err != nil {
+		return err
+	}
+	if violations > 0 {
+		return fmt.Errorf("moving sections to channel_videos left %d foreign key violations", violations)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	slog.Info("Moved video sections to channel_videos.")
+	return nil
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" %s;`, table, column, definition))
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Added column", "table", table, "column", column)
+	return nil
+}
+
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s);`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+func hasTable(db *sql.DB, table string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?);`, table).Scan(&exists)
+	return exists, err
+}
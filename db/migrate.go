@@ -0,0 +1,34 @@
+package db
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"github.com/ozencb/couchtube/db/dialect"
+	"github.com/ozencb/couchtube/db/migrations"
+)
+
+// Migrate applies all pending schema migrations.
+func Migrate(db *sql.DB) error {
+	if GetDialect() == dialect.SQLite {
+		if err := upgradeLegacySchema(db); err != nil {
+			return err
+		}
+	}
+
+	migrator, err := migrations.NewMigrator(db, GetDialect())
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Database schema is up to date.")
+	return nil
+}
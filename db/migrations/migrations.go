@@ -0,0 +1,257 @@
+// Package migrations applies the numbered SQL migrations embedded in the
+// binary. Each dialect has its own directory of files named
+// NNNN_description.up.sql and NNNN_description.down.sql.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ozencb/couchtube/db/dialect"
+)
+
+//go:embed sqlite/*.sql postgres/*.sql
+var files embed.FS
+
+// lockID is the PostgreSQL advisory lock held while migrating, so replicas
+// starting at the same time don't race each other.
+const lockID = 8363
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect.Dialect
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, sqlDialect dialect.Dialect) (*Migrator, error) {
+	migrations, err := load(string(sqlDialect))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: sqlDialect, migrations: migrations}, nil
+}
+
+func load(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, description, found := strings.Cut(strings.TrimSuffix(name, "."+direction+".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil {
+			return nil, fmt.Errorf("migration %s is not named NNNN_description.%s.sql", name, direction)
+		}
+
+		content, err := fs.ReadFile(files, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: description}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up migration", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	_, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		"version" INTEGER NOT NULL PRIMARY KEY,
+		"name" TEXT NOT NULL,
+		"applied_at" BIGINT NOT NULL
+	);`)
+	return err
+}
+
+func (m *Migrator) applied(tx *sql.Tx) (map[int]int64, error) {
+	query := `SELECT version, applied_at FROM schema_migrations`
+
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.Query(query)
+	} else {
+		rows, err = m.db.Query(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]int64{}
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// Status lists every known migration along with when it was applied.
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			t := time.Unix(appliedAt, 0).UTC()
+			status.AppliedAt = &t
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Up applies all pending migrations in order, each in its own transaction,
+// and returns the ones it applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range m.migrations {
+		ran, err := m.run(migration, true)
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// Down reverts the given number of most recently applied migrations and
+// returns the ones it reverted.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := m.migrations[i]
+		ran, err := m.run(migration, false)
+		if err != nil {
+			return reverted, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			reverted = append(reverted, migration)
+		}
+	}
+
+	return reverted, nil
+}
+
+// run applies or reverts a single migration unless that already happened,
+// reporting whether it did anything.
+func (m *Migrator) run(migration Migration, up bool) (bool, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if m.dialect == dialect.Postgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+			return false, err
+		}
+	}
+
+	applied, err := m.applied(tx)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := applied[migration.Version]; ok == up {
+		return false, nil
+	}
+
+	if up {
+		if _, err := tx.Exec(migration.Up); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(m.dialect.Rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			migration.Version, migration.Name, time.Now().UTC().Unix())
+	} else {
+		if migration.Down == "" {
+			return false, fmt.Errorf("no down migration")
+		}
+		if _, err := tx.Exec(migration.Down); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(m.dialect.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), migration.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
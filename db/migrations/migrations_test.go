@@ -0,0 +1,209 @@
+package migrations
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/ozencb/couchtube/db/dialect"
+	_ "modernc.org/sqlite"
+)
+
+// testDatabaseURLEnv names the PostgreSQL database the PostgreSQL tests run
+// against. They are skipped when it is not set. Everything in it is dropped.
+const testDatabaseURLEnv = "COUCHTUBE_TEST_DATABASE_URL"
+
+func TestDialectsMatch(t *testing.T) {
+	sqlite, err := load(string(dialect.SQLite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgres, err := load(string(dialect.Postgres))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("got %d SQLite migrations and %d PostgreSQL migrations", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("migration %04d_%s of SQLite is %04d_%s for PostgreSQL",
+				sqlite[i].Version, sqlite[i].Name, postgres[i].Version, postgres[i].Name)
+		}
+		if sqlite[i].Version != i+1 {
+			t.Errorf("migration %04d_%s should be number %04d", sqlite[i].Version, sqlite[i].Name, i+1)
+		}
+		if sqlite[i].Down == "" || postgres[i].Down == "" {
+			t.Errorf("migration %04d_%s has no down migration", sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "couchtube.db") + "?_pragma=foreign_keys(1)"
+	database, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	testMigrations(t, database, dialect.SQLite)
+}
+
+func TestPostgres(t *testing.T) {
+	database := openPostgres(t)
+
+	testMigrations(t, database, dialect.Postgres)
+}
+
+// TestPostgresConcurrent migrates from several replicas at once, which the
+// advisory lock keeps from applying a migration twice.
+func TestPostgresConcurrent(t *testing.T) {
+	database := openPostgres(t)
+
+	migrators := make([]*Migrator, 4)
+	for i := range migrators {
+		migrator, err := NewMigrator(database, dialect.Postgres)
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrators[i] = migrator
+	}
+
+	var wg sync.WaitGroup
+	applied := make([][]Migration, len(migrators))
+	errs := make([]error, len(migrators))
+	for i, migrator := range migrators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied[i], errs[i] = migrator.Up()
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range migrators {
+		if errs[i] != nil {
+			t.Errorf("replica %d: %v", i, errs[i])
+		}
+		total += len(applied[i])
+	}
+	if want := len(migrators[0].migrations); total != want {
+		t.Errorf("replicas applied %d migrations together, want %d", total, want)
+	}
+}
+
+// openPostgres opens the database named by testDatabaseURLEnv with every
+// migration reverted, or skips the test when it is not set.
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv(testDatabaseURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", testDatabaseURLEnv)
+	}
+
+	database, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	migrator, err := NewMigrator(database, dialect.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Down(len(migrator.migrations)); err != nil {
+		t.Fatal(err)
+	}
+
+	return database
+}
+
+// testMigrations applies every migration to an empty database, checks that
+// the queries the repositories rely on work on the result, and reverts them
+// all again.
+func testMigrations(t *testing.T, database *sql.DB, sqlDialect dialect.Dialect) {
+	t.Helper()
+
+	migrator, err := NewMigrator(database, sqlDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := len(migrator.migrations)
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != count {
+		t.Fatalf("applied %d migrations, want %d", len(applied), count)
+	}
+	if applied, err := migrator.Up(); err != nil || len(applied) != 0 {
+		t.Fatalf("applying again applied %d migrations, err %v", len(applied), err)
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("migration %04d_%s is pending after applying all", status.Version, status.Name)
+		}
+	}
+
+	// Channel names are unique per lineup through an expression index,
+	// which ON CONFLICT has to name the same way
+	var first, second int
+	upsert := sqlDialect.Rebind(`
+        INSERT INTO channels (name, source) VALUES (?, ?)
+        ON CONFLICT ((COALESCE(profile_id, 0)), name) DO UPDATE SET source = excluded.source
+        RETURNING id
+    `)
+	if err := database.QueryRow(upsert, "News", "list").Scan(&first); err != nil {
+		t.Fatalf("upserting a channel: %v", err)
+	}
+	if err := database.QueryRow(upsert, "News", "library").Scan(&second); err != nil {
+		t.Fatalf("upserting a channel again: %v", err)
+	}
+	if first != second {
+		t.Errorf("upserting the same channel twice gave IDs %d and %d", first, second)
+	}
+
+	// OpenID Connect subjects are unique, users without one are not
+	insertUser := sqlDialect.Rebind(`
+        INSERT INTO users (name, role, created_at, oidc_issuer, oidc_subject) VALUES (?, 'viewer', 0, NULLIF(?, ''), NULLIF(?, ''))
+        ON CONFLICT DO NOTHING
+        RETURNING id
+    `)
+	var id int
+	for _, user := range [][3]string{{"kids", "", ""}, {"parents", "", ""}, {"sso", "https://auth.example.org", "1234"}} {
+		if err := database.QueryRow(insertUser, user[0], user[1], user[2]).Scan(&id); err != nil {
+			t.Fatalf("inserting user %s: %v", user[0], err)
+		}
+	}
+	if err := database.QueryRow(insertUser, "sso-2", "https://auth.example.org", "1234").Scan(&id); err != sql.ErrNoRows {
+		t.Errorf("inserting a second user with the same subject gave %v, want no rows", err)
+	}
+
+	reverted, err := migrator.Down(count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != count {
+		t.Fatalf("reverted %d migrations, want %d", len(reverted), count)
+	}
+	if _, err := database.Exec(`SELECT 1 FROM channels`); err == nil {
+		t.Error("channels table still exists after reverting every migration")
+	}
+
+	if applied, err := migrator.Up(); err != nil || len(applied) != count {
+		t.Fatalf("applying after reverting applied %d migrations, err %v", len(applied), err)
+	}
+}
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS channels (
+	"id" SERIAL PRIMARY KEY,
+	"name" TEXT,
+	"source" TEXT NOT NULL DEFAULT 'list',
+	UNIQUE(name)
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	"id" TEXT NOT NULL PRIMARY KEY,
+	"source" TEXT NOT NULL DEFAULT 'youtube',
+	"url" TEXT,
+	"status" TEXT NOT NULL DEFAULT 'active',
+	"report_count" INTEGER NOT NULL DEFAULT 0,
+	"last_reported_at" BIGINT
+);
+
+-- A video can appear several times in a channel, or in several channels,
+-- each time with its own section, so section bounds live here.
+CREATE TABLE IF NOT EXISTS channel_videos (
+	"id" SERIAL PRIMARY KEY,
+	"channel_id" INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	"video_id" TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	"position" INTEGER NOT NULL,
+	"section_start" INTEGER NOT NULL,
+	"section_end" INTEGER NOT NULL,
+	CHECK (section_end > section_start)
+);
+
+CREATE TABLE IF NOT EXISTS video_reports (
+	"video_id" TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	"reporter" TEXT NOT NULL,
+	"error_code" INTEGER,
+	"reported_at" BIGINT NOT NULL,
+	UNIQUE(video_id, reporter)
+);
+
+CREATE INDEX IF NOT EXISTS idx_videos_channel_id ON channel_videos(channel_id, video_id);
+CREATE INDEX IF NOT EXISTS idx_video_reports_video_id ON video_reports(video_id, reported_at);
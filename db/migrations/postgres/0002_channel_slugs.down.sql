@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_channels_number;
+DROP INDEX IF EXISTS idx_channels_slug;
+
+ALTER TABLE channels DROP COLUMN IF EXISTS "number";
+ALTER TABLE channels DROP COLUMN IF EXISTS "slug";
@@ -0,0 +1,19 @@
+-- Admin API tokens and web UI sessions. Only SHA-256 hashes of the secrets
+-- are stored, so a copy of the database can't be used to sign in.
+CREATE TABLE IF NOT EXISTS api_tokens (
+	"id" SERIAL PRIMARY KEY,
+	"name" TEXT NOT NULL,
+	"token_hash" TEXT NOT NULL,
+	"created_at" BIGINT NOT NULL,
+	"last_used_at" BIGINT,
+	UNIQUE(name),
+	UNIQUE(token_hash)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	"id_hash" TEXT NOT NULL PRIMARY KEY,
+	"created_at" BIGINT NOT NULL,
+	"expires_at" BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,3 @@
+-- Sessions started through an OpenID Connect provider belong to a named
+-- user. Password sign-ins are all "admin".
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS "name" TEXT NOT NULL DEFAULT 'admin';
@@ -0,0 +1,3 @@
+ALTER TABLE channels DROP COLUMN "owner_id";
+ALTER TABLE sessions DROP COLUMN "user_id";
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,12 @@
+-- Personal lineups are dropped, since their channels may reuse the names,
+-- slugs and numbers of shared ones
+DELETE FROM channels WHERE profile_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_channels_name;
+DROP INDEX IF EXISTS idx_channels_slug;
+DROP INDEX IF EXISTS idx_channels_number;
+ALTER TABLE channels DROP COLUMN IF EXISTS "profile_id";
+
+ALTER TABLE channels ADD CONSTRAINT channels_name_key UNIQUE (name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_slug ON channels(slug);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_number ON channels(number);
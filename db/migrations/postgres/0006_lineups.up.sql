@@ -0,0 +1,12 @@
+-- Channels belong to the shared lineup, or to the personal lineup of the
+-- user in profile_id. Names, slugs and numbers only have to be unique within
+-- a lineup.
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS "profile_id" INTEGER REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE channels DROP CONSTRAINT IF EXISTS channels_name_key;
+DROP INDEX IF EXISTS idx_channels_slug;
+DROP INDEX IF EXISTS idx_channels_number;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_name ON channels ((COALESCE(profile_id, 0)), name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_slug ON channels ((COALESCE(profile_id, 0)), slug);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_number ON channels ((COALESCE(profile_id, 0)), number);
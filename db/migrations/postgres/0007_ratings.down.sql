@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS "pin_hash";
+ALTER TABLE users DROP COLUMN IF EXISTS "max_rating";
+ALTER TABLE channel_videos DROP COLUMN IF EXISTS "rating";
+ALTER TABLE channels DROP COLUMN IF EXISTS "rating";
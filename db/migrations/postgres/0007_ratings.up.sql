@@ -0,0 +1,9 @@
+-- Channels and their entries may carry a content rating, like PG-13 or an
+-- age. Entries without one fall back to the rating of their channel.
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS "rating" TEXT;
+ALTER TABLE channel_videos ADD COLUMN IF NOT EXISTS "rating" TEXT;
+
+-- Viewer profiles only see content up to their max rating, and may need a
+-- PIN to switch to
+ALTER TABLE users ADD COLUMN IF NOT EXISTS "max_rating" TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS "pin_hash" TEXT;
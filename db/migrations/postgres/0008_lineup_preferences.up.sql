@@ -0,0 +1,15 @@
+-- How a viewer arranges the channels of the lineup they watch: favorites,
+-- hidden channels and their own order. Preferences belong to a user, or to
+-- a browser without a sign-in through the hash of its device token.
+CREATE TABLE IF NOT EXISTS lineup_preferences (
+	"id" SERIAL PRIMARY KEY,
+	"user_id" INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	"device_hash" TEXT,
+	"channel_id" INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	"position" INTEGER NOT NULL,
+	"favorite" BOOLEAN NOT NULL DEFAULT FALSE,
+	"hidden" BOOLEAN NOT NULL DEFAULT FALSE,
+	CHECK ((user_id IS NULL) <> (device_hash IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_lineup_preferences_viewer ON lineup_preferences ((COALESCE(user_id, 0)), (COALESCE(device_hash, '')), channel_id);
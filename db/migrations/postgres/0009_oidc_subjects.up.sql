@@ -0,0 +1,7 @@
+-- Users who sign in through an OpenID Connect provider are identified by
+-- the issuer and subject of their ID token, never by their name, so nobody
+-- can take over another user by picking the same user name at the provider.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS "oidc_issuer" TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS "oidc_subject" TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users(oidc_issuer, oidc_subject);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS video_reports;
+DROP TABLE IF EXISTS channel_videos;
+DROP TABLE IF EXISTS videos;
+DROP TABLE IF EXISTS channels;
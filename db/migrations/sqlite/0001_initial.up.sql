@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS channels (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"name" TEXT,
+	"source" TEXT NOT NULL DEFAULT 'list',
+	UNIQUE(name)
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	"id" TEXT NOT NULL PRIMARY KEY,
+	"source" TEXT NOT NULL DEFAULT 'youtube',
+	"url" TEXT,
+	"status" TEXT NOT NULL DEFAULT 'active',
+	"report_count" INTEGER NOT NULL DEFAULT 0,
+	"last_reported_at" INTEGER
+);
+
+-- A video can appear several times in a channel, or in several channels,
+-- each time with its own section, so section bounds live here.
+CREATE TABLE IF NOT EXISTS channel_videos (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"channel_id" INTEGER NOT NULL,
+	"video_id" TEXT NOT NULL,
+	"position" INTEGER NOT NULL,
+	"section_start" INTEGER NOT NULL,
+	"section_end" INTEGER NOT NULL,
+	FOREIGN KEY(channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	CHECK (section_end > section_start)
+);
+
+CREATE TABLE IF NOT EXISTS video_reports (
+	"video_id" TEXT NOT NULL,
+	"reporter" TEXT NOT NULL,
+	"error_code" INTEGER,
+	"reported_at" INTEGER NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	UNIQUE(video_id, reporter)
+);
+
+CREATE INDEX IF NOT EXISTS idx_videos_channel_id ON channel_videos(channel_id, video_id);
+CREATE INDEX IF NOT EXISTS idx_video_reports_video_id ON video_reports(video_id, reported_at);
@@ -0,0 +1,8 @@
+-- Slugs and channel numbers give channels an address that survives
+-- re-imports, unlike their generated ID. Existing channels get a slug from
+-- their name on the next startup.
+ALTER TABLE channels ADD COLUMN "slug" TEXT;
+ALTER TABLE channels ADD COLUMN "number" TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_slug ON channels(slug);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_number ON channels(number);
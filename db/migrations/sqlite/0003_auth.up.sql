@@ -0,0 +1,19 @@
+-- Admin API tokens and web UI sessions. Only SHA-256 hashes of the secrets
+-- are stored, so a copy of the database can't be used to sign in.
+CREATE TABLE IF NOT EXISTS api_tokens (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"name" TEXT NOT NULL,
+	"token_hash" TEXT NOT NULL,
+	"created_at" INTEGER NOT NULL,
+	"last_used_at" INTEGER,
+	UNIQUE(name),
+	UNIQUE(token_hash)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	"id_hash" TEXT NOT NULL PRIMARY KEY,
+	"created_at" INTEGER NOT NULL,
+	"expires_at" INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
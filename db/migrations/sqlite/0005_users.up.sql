@@ -0,0 +1,15 @@
+-- Users sign in with a password or through an OpenID Connect provider and
+-- have a role: viewer, curator or admin. Curators may edit the channels
+-- they own.
+CREATE TABLE IF NOT EXISTS users (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"name" TEXT NOT NULL,
+	"role" TEXT NOT NULL DEFAULT 'viewer',
+	"password_hash" TEXT,
+	"created_at" INTEGER NOT NULL,
+	UNIQUE(name)
+);
+
+-- Sessions without a user are sign-ins with the admin password
+ALTER TABLE sessions ADD COLUMN "user_id" INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE channels ADD COLUMN "owner_id" INTEGER REFERENCES users(id) ON DELETE SET NULL;
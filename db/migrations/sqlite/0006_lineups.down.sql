@@ -0,0 +1,38 @@
+-- Personal lineups are dropped, since their channels may reuse the names,
+-- slugs and numbers of shared ones
+DELETE FROM channels WHERE profile_id IS NOT NULL;
+
+CREATE TABLE channels_old (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"name" TEXT,
+	"source" TEXT NOT NULL DEFAULT 'list',
+	"slug" TEXT,
+	"number" TEXT,
+	"owner_id" INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	UNIQUE(name)
+);
+INSERT INTO channels_old (id, name, source, slug, number, owner_id)
+SELECT id, name, source, slug, number, owner_id FROM channels;
+
+CREATE TABLE channel_videos_old (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"channel_id" INTEGER NOT NULL,
+	"video_id" TEXT NOT NULL,
+	"position" INTEGER NOT NULL,
+	"section_start" INTEGER NOT NULL,
+	"section_end" INTEGER NOT NULL,
+	FOREIGN KEY(channel_id) REFERENCES channels_old(id) ON DELETE CASCADE,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	CHECK (section_end > section_start)
+);
+INSERT INTO channel_videos_old (id, channel_id, video_id, position, section_start, section_end)
+SELECT id, channel_id, video_id, position, section_start, section_end FROM channel_videos;
+
+DROP TABLE channel_videos;
+DROP TABLE channels;
+ALTER TABLE channels_old RENAME TO channels;
+ALTER TABLE channel_videos_old RENAME TO channel_videos;
+
+CREATE INDEX IF NOT EXISTS idx_videos_channel_id ON channel_videos(channel_id, video_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_slug ON channels(slug);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_number ON channels(number);
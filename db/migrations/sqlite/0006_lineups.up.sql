@@ -0,0 +1,40 @@
+-- Channels belong to the shared lineup, or to the personal lineup of the
+-- user in profile_id. Names, slugs and numbers only have to be unique within
+-- a lineup, which takes rebuilding the table in SQLite. channel_videos is
+-- rebuilt along with it, since dropping channels would delete its rows.
+CREATE TABLE channels_new (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"name" TEXT,
+	"source" TEXT NOT NULL DEFAULT 'list',
+	"slug" TEXT,
+	"number" TEXT,
+	"owner_id" INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	"profile_id" INTEGER REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO channels_new (id, name, source, slug, number, owner_id)
+SELECT id, name, source, slug, number, owner_id FROM channels;
+
+CREATE TABLE channel_videos_new (
+	"id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	"channel_id" INTEGER NOT NULL,
+	"video_id" TEXT NOT NULL,
+	"position" INTEGER NOT NULL,
+	"section_start" INTEGER NOT NULL,
+	"section_end" INTEGER NOT NULL,
+	FOREIGN KEY(channel_id) REFERENCES channels_new(id) ON DELETE CASCADE,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	CHECK (section_end > section_start)
+);
+INSERT INTO channel_videos_new (id, channel_id, video_id, position, section_start, section_end)
+SELECT id, channel_id, video_id, position, section_start, section_end FROM channel_videos;
+
+DROP TABLE channel_videos;
+DROP TABLE channels;
+-- Renaming also points the foreign key of channel_videos at channels
+ALTER TABLE channels_new RENAME TO channels;
+ALTER TABLE channel_videos_new RENAME TO channel_videos;
+
+CREATE INDEX IF NOT EXISTS idx_videos_channel_id ON channel_videos(channel_id, video_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_name ON channels(COALESCE(profile_id, 0), name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_slug ON channels(COALESCE(profile_id, 0), slug);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_number ON channels(COALESCE(profile_id, 0), number);
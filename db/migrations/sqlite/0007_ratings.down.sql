@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN "pin_hash";
+ALTER TABLE users DROP COLUMN "max_rating";
+ALTER TABLE channel_videos DROP COLUMN "rating";
+ALTER TABLE channels DROP COLUMN "rating";
@@ -0,0 +1,9 @@
+-- Channels and their entries may carry a content rating, like PG-13 or an
+-- age. Entries without one fall back to the rating of their channel.
+ALTER TABLE channels ADD COLUMN "rating" TEXT;
+ALTER TABLE channel_videos ADD COLUMN "rating" TEXT;
+
+-- Viewer profiles only see content up to their max rating, and may need a
+-- PIN to switch to
+ALTER TABLE users ADD COLUMN "max_rating" TEXT;
+ALTER TABLE users ADD COLUMN "pin_hash" TEXT;
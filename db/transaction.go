@@ -1,14 +1,18 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"log/slog"
 )
 
-func WithTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
-	tx, err := db.Begin()
+// WithTransaction runs fn in a transaction, committing it if fn succeeds and
+// rolling it back otherwise or when ctx is canceled. A failed commit is
+// returned like an error of fn.
+func WithTransaction(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Failed to start transaction: %v", err)
+		slog.Error("Failed to start transaction", "error", err)
 		return err
 	}
 
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/config"
+	"github.com/ozencb/couchtube/helpers"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+	"github.com/ozencb/couchtube/services"
+)
+
+const (
+	oidcFlowCookie = "couchtube_oidc"
+	// oidcFlowTTL is how long a user has to sign in at the provider.
+	oidcFlowTTL = 10 * time.Minute
+)
+
+type Auth struct {
+	Service *services.AuthService
+	Config  *config.Config
+}
+
+func NewAuthHandler(service *services.AuthService, cfg *config.Config) *Auth {
+	return &Auth{Service: service, Config: cfg}
+}
+
+// Login signs in to the web UI with the password of a user, or the admin
+// password, setting the session cookie.
+func (h *Auth) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	var login jsonmodels.LoginRequestJson
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		apperrors.Write(w, r, apperrors.Validation("Request body is not valid JSON").WithDetails(map[string]interface{}{"reason": err.Error()}))
+		return
+	}
+
+	user := login.Name
+	if user == "" {
+		user = "admin"
+	}
+
+	sessionID, expiresAt, err := h.Service.Login(r.Context(), login.Name, login.Password)
+	if err != nil {
+		if apperrors.Is(err, apperrors.CodeUnauthenticated) {
+			h.Service.Logger.WarnContext(r.Context(), "Failed sign-in attempt", "user", user)
+		}
+		writeError(w, r, h.Service.Logger, "Failed to sign in", err)
+		return
+	}
+
+	h.Service.Logger.InfoContext(r.Context(), "User signed in", "user", user)
+
+	http.SetCookie(w, sessionCookie(r, sessionID, expiresAt))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// Profiles lists the viewer profiles on GET, and switches to one on POST,
+// setting the session cookie.
+func (h *Auth) Profiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		profiles, err := h.Service.ListProfiles(r.Context())
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to load profiles", err)
+			return
+		}
+
+		list := make([]map[string]interface{}, 0, len(profiles))
+		for _, profile := range profiles {
+			list = append(list, map[string]interface{}{
+				"name":      profile.Name,
+				"maxRating": profile.MaxRating,
+				"pin":       profile.PinHash != "",
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"profiles": list})
+	case http.MethodPost:
+		var request jsonmodels.ProfileRequestJson
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apperrors.Write(w, r, apperrors.Validation("Request body is not valid JSON").WithDetails(map[string]interface{}{"reason": err.Error()}))
+			return
+		}
+
+		client := helpers.Fingerprint(helpers.ClientIP(r, h.Config.ClientIPHeader, h.Config.TrustedProxies))
+		sessionID, expiresAt, err := h.Service.SwitchProfile(r.Context(), request.Name, request.Pin, client)
+		if err != nil {
+			switch {
+			case apperrors.Is(err, apperrors.CodeUnauthenticated):
+				h.Service.Logger.WarnContext(r.Context(), "Wrong PIN for profile", "profile", request.Name)
+			case apperrors.Is(err, apperrors.CodeTooManyRequests):
+				h.Service.Logger.WarnContext(r.Context(), "Profile locked after wrong PINs", "profile", request.Name)
+			}
+			writeError(w, r, h.Service.Logger, "Failed to switch profile", err)
+			return
+		}
+
+		h.Service.Logger.InfoContext(r.Context(), "Profile switched", "profile", request.Name)
+
+		http.SetCookie(w, sessionCookie(r, sessionID, expiresAt))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	default:
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+	}
+}
+
+// Logout ends the web UI session of the request, if any.
+func (h *Auth) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	if cookie, err := r.Cookie(auth.SessionCookie); err == nil {
+		if err := h.Service.Logout(r.Context(), cookie.Value); err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to sign out", err)
+			return
+		}
+	}
+
+	http.SetCookie(w, sessionCookie(r, "", time.Unix(0, 0)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// OIDCLogin sends the browser to the OpenID Connect provider to sign in.
+func (h *Auth) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	url, flow, err := h.Service.StartOIDCLogin(r.Context())
+	if err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to start sign-in", err)
+		return
+	}
+
+	// The provider sends the browser back with a top-level navigation from
+	// its own site, which only takes lax cookies along
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    flow.String(),
+		Path:     "/api/oidc/",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// OIDCCallback finishes signing in once the OpenID Connect provider sends
+// the browser back, setting the session cookie.
+func (h *Auth) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		apperrors.Write(w, r, apperrors.Upstream("The sign-in provider refused the sign-in", nil).WithDetails(map[string]interface{}{
+			"reason":      providerError,
+			"description": query.Get("error_description"),
+		}))
+		return
+	}
+
+	var flow auth.OIDCFlow
+	if cookie, err := r.Cookie(oidcFlowCookie); err == nil {
+		flow, _ = auth.ParseOIDCFlow(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: "/api/oidc/", MaxAge: -1})
+
+	sessionID, expiresAt, err := h.Service.FinishOIDCLogin(r.Context(), query.Get("state"), query.Get("code"), flow)
+	if err != nil {
+		if apperrors.Is(err, apperrors.CodeForbidden) {
+			h.Service.Logger.WarnContext(r.Context(), "Sign-in without a role", "error", err)
+		}
+		writeError(w, r, h.Service.Logger, "Failed to sign in", err)
+		return
+	}
+
+	http.SetCookie(w, sessionCookie(r, sessionID, expiresAt))
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// sessionCookie returns the session cookie. It is kept from scripts and
+// cross-site requests, and only sent over HTTPS when the request came in
+// that way, directly or through a proxy.
+func sessionCookie(r *http.Request, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
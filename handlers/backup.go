@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/config"
+	"github.com/ozencb/couchtube/services"
+)
+
+type Backup struct {
+	Service *services.BackupService
+	Config  *config.Config
+}
+
+func NewBackupHandler(service *services.BackupService, cfg *config.Config) *Backup {
+	return &Backup{Service: service, Config: cfg}
+}
+
+// DownloadBackup streams a fresh snapshot of the database. Taking it isn't
+// limited by the request timeout, since that of a large database can take
+// longer.
+func (h *Backup) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	path, err := h.Service.SnapshotToTemp(context.WithoutCancel(r.Context()))
+	if err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to create backup", err)
+		return
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filepath.Base(path)+`"`)
+	http.ServeFile(w, r, path)
+}
+
+// RestoreBackup replaces the database with the snapshot sent as the request
+// body, of at most MaxRestoreSize megabytes. Once the snapshot is uploaded,
+// the restore isn't limited by the request timeout, so it is never left
+// half done.
+func (h *Backup) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	file, err := os.CreateTemp("", "couchtube-upload-*.db")
+	if err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to restore backup", err)
+		return
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, http.MaxBytesReader(w, r.Body, int64(h.Config.MaxRestoreSize)<<20))
+	file.Close()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apperrors.Write(w, r, apperrors.Validation("The backup is too large").WithDetails(map[string]interface{}{"max_size_mb": h.Config.MaxRestoreSize}))
+		return
+	}
+	if err != nil {
+		apperrors.Write(w, r, apperrors.Validation("Failed to read backup"))
+		return
+	}
+
+	err = h.Service.Restore(context.WithoutCancel(r.Context()), file.Name())
+	if err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to restore backup", err)
+		return
+	}
+
+	h.Service.Logger.InfoContext(r.Context(), "Database restored from uploaded backup")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
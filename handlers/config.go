@@ -1,16 +1,54 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
-	"strconv"
 
+	"github.com/ozencb/couchtube/auth"
 	"github.com/ozencb/couchtube/config"
+	"github.com/ozencb/couchtube/services"
 )
 
-func GetConfigs(w http.ResponseWriter, r *http.Request) {
-	readonlyEnabled := config.GetReadonlyMode()
+type Settings struct {
+	Config *config.Config
+	Auth   *services.AuthService
+}
+
+func NewSettingsHandler(cfg *config.Config, authService *services.AuthService) *Settings {
+	return &Settings{Config: cfg, Auth: authService}
+}
+
+// GetConfigs tells the web UI what it may offer: whether the lineup can be
+// changed, how users can sign in and the role, profile and max rating of the
+// request, if it is signed in.
+func (h *Settings) GetConfigs(w http.ResponseWriter, r *http.Request) {
+	userPasswords, err := h.Auth.UserPasswordsEnabled(r.Context())
+	if err != nil {
+		writeError(w, r, h.Auth.Logger, "Failed to load settings", err)
+		return
+	}
+
+	var role auth.Role
+	var profile string
+	maxRating := h.Config.DefaultMaxRating
+	identity := auth.FromContext(r.Context())
+	if identity != nil {
+		role = identity.Role
+		maxRating = identity.MaxRating
+		if identity.UserID != 0 {
+			profile = identity.Name
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"readonly": ` + strconv.FormatBool(readonlyEnabled) + `}`))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"readonly":  h.Config.ReadonlyMode,
+		"login":     h.Auth.PasswordEnabled() || userPasswords,
+		"oidc":      h.Auth.OIDCEnabled(),
+		"role":      role,
+		"admin":     role.Includes(auth.RoleAdmin),
+		"profile":   profile,
+		"maxRating": maxRating,
+	})
 }
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/ozencb/couchtube/apperrors"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+// CuratedChannels lists the channels the caller may edit on GET, creates a
+// channel owned by the caller on POST and deletes the channel in ?channel=
+// on DELETE.
+func (h *Media) CuratedChannels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		channels, err := h.Service.EditableChannels(r.Context())
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to load channels", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"channels": channels})
+	case http.MethodPost:
+		var channel jsonmodels.ChannelJson
+		if err := json.NewDecoder(r.Body).Decode(&channel); err != nil {
+			apperrors.Write(w, r, apperrors.Validation("Request body is not valid JSON").WithDetails(map[string]interface{}{"reason": err.Error()}))
+			return
+		}
+
+		created, err := h.Service.CreateChannel(r.Context(), channel)
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to create channel", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"channel": created})
+	case http.MethodDelete:
+		channelRef := r.URL.Query().Get("channel")
+		if channelRef == "" {
+			apperrors.Write(w, r, apperrors.Validation("channel is required"))
+			return
+		}
+
+		if err := h.Service.DeleteChannel(r.Context(), channelRef); err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to delete channel", err)
+			return
+		}
+
+		h.Service.Logger.InfoContext(r.Context(), "Channel deleted", "channel", channelRef)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	default:
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+	}
+}
+
+// ChannelVideos lists the lineup of the channel in ?channel= on GET, adds a
+// video to a channel on POST and removes ?entry-id= from ?channel= on
+// DELETE. The caller must be allowed to edit the channel.
+func (h *Media) ChannelVideos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		channelRef := r.URL.Query().Get("channel")
+		if channelRef == "" {
+			apperrors.Write(w, r, apperrors.Validation("channel is required"))
+			return
+		}
+
+		entries, err := h.Service.ChannelEntries(r.Context(), channelRef)
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to load videos", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"videos": entries})
+	case http.MethodPost:
+		var request jsonmodels.ChannelVideoRequestJson
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apperrors.Write(w, r, apperrors.Validation("Request body is not valid JSON").WithDetails(map[string]interface{}{"reason": err.Error()}))
+			return
+		}
+		if request.Channel == "" {
+			apperrors.Write(w, r, apperrors.Validation("channel is required"))
+			return
+		}
+
+		if err := h.Service.AddVideo(r.Context(), request.Channel, request.VideoJson); err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to add video", err)
+			return
+		}
+
+		h.Service.Logger.InfoContext(r.Context(), "Video added", "channel", request.Channel, "video_id", request.Id)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	case http.MethodDelete:
+		channelRef := r.URL.Query().Get("channel")
+		if channelRef == "" {
+			apperrors.Write(w, r, apperrors.Validation("channel is required"))
+			return
+		}
+		entryID, err := strconv.Atoi(r.URL.Query().Get("entry-id"))
+		if err != nil {
+			apperrors.Write(w, r, apperrors.Validation("Invalid entry-id"))
+			return
+		}
+
+		if err := h.Service.RemoveEntry(r.Context(), channelRef, entryID); err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to remove video", err)
+			return
+		}
+
+		h.Service.Logger.InfoContext(r.Context(), "Video removed", "channel", channelRef, "entry_id", entryID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	default:
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+	}
+}
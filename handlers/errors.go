@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ozencb/couchtube/apperrors"
+)
+
+// writeError sends err in the JSON error envelope. Errors that aren't typed
+// are sent as internal errors with message instead of their own text, and
+// server side failures are logged.
+func writeError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, message string, err error) {
+	e := apperrors.From(err, message)
+	if e.Status() >= http.StatusInternalServerError {
+		logger.ErrorContext(r.Context(), message, "error", err)
+	}
+	apperrors.Write(w, r, e)
+}
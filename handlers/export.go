@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ozencb/couchtube/apperrors"
+)
+
+// ExportChannels returns the caller's lineup, or the lineup of the user in
+// ?profile=, as a channel list that can be imported again. Repeat the channel
+// parameter to export only some channels.
+func (h *Media) ExportChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	export, err := h.Service.ExportChannels(r.Context(), r.URL.Query().Get("profile"), r.URL.Query()["channel"])
+	if err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to export channels", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(export)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+)
+
+// checkTimeout bounds how long a readiness check may take, so a hung
+// database makes the check fail rather than the probe time out.
+const checkTimeout = 2 * time.Second
+
+const (
+	statusOK      = "ok"
+	statusFailing = "failing"
+)
+
+// HealthCheck returns an error when the component it checks is not working.
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+type checkResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Uptime   string `json:"uptime,omitempty"`
+}
+
+// Health serves the liveness and readiness endpoints. The server only counts
+// as ready once startup is done and every registered check passes, and goes
+// back to not ready once it starts shutting down, so load balancers stop
+// sending it new requests.
+type Health struct {
+	started  time.Time
+	starting atomic.Bool
+	stopping atomic.Bool
+
+	mu     sync.Mutex
+	checks []namedCheck
+}
+
+func NewHealthHandler() *Health {
+	h := &Health{started: time.Now()}
+	h.starting.Store(true)
+	return h
+}
+
+// AddCheck adds a check that must pass for the server to be ready.
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// SetStarted marks startup, including the initial import, as done.
+func (h *Health) SetStarted() {
+	h.starting.Store(false)
+}
+
+// AfterStartup answers requests with an unavailable error until startup is
+// done, so nothing is served from a database that is still being imported.
+func (h *Health) AfterStartup(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.starting.Load() {
+			apperrors.Write(w, r, apperrors.Unavailable("Server is starting up"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// SetStopping marks the server as shutting down.
+func (h *Health) SetStopping() {
+	h.stopping.Store(true)
+}
+
+// Live reports that the process is up and serving requests. It doesn't
+// depend on the database, so orchestrators don't restart the server over a
+// problem a restart won't fix.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	writeHealth(w, map[string]checkResult{
+		"process": {Status: statusOK, Uptime: time.Since(h.started).Round(time.Second).String()},
+	})
+}
+
+// Ready runs every check and reports whether the server can take traffic.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	results := map[string]checkResult{"lifecycle": h.lifecycleResult()}
+
+	h.mu.Lock()
+	checks := append([]namedCheck(nil), h.checks...)
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	for _, check := range checks {
+		results[check.name] = runCheck(ctx, check.check)
+	}
+
+	writeHealth(w, results)
+}
+
+func (h *Health) lifecycleResult() checkResult {
+	switch {
+	case h.stopping.Load():
+		return checkResult{Status: statusFailing, Error: "shutting down"}
+	case h.starting.Load():
+		return checkResult{Status: statusFailing, Error: "starting up"}
+	default:
+		return checkResult{Status: statusOK}
+	}
+}
+
+func runCheck(ctx context.Context, check HealthCheck) checkResult {
+	start := time.Now()
+	err := check(ctx)
+	result := checkResult{Status: statusOK, Duration: time.Since(start).String()}
+
+	if err != nil {
+		result.Status = statusFailing
+		result.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Error = "timed out"
+		}
+	}
+
+	return result
+}
+
+func writeHealth(w http.ResponseWriter, results map[string]checkResult) {
+	status := statusOK
+	for _, result := range results {
+		if result.Status != statusOK {
+			status = statusFailing
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status == statusOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAfterStartup(t *testing.T) {
+	health := NewHealthHandler()
+	handler := health.AfterStartup(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	serve := func() int {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, "/api/channels", nil))
+		return recorder.Code
+	}
+
+	if got := serve(); got != http.StatusServiceUnavailable {
+		t.Errorf("got status %d during startup, want %d", got, http.StatusServiceUnavailable)
+	}
+	health.SetStarted()
+	if got := serve(); got != http.StatusOK {
+		t.Errorf("got status %d after startup, want %d", got, http.StatusOK)
+	}
+}
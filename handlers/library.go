@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/library"
+)
+
+type Library struct {
+	Root http.Dir
+}
+
+func NewLibraryHandler(root string) *Library {
+	return &Library{Root: http.Dir(root)}
+}
+
+// ServeMedia serves the media files of the library, the ones the scanner
+// picks up, and nothing else in its folders. http.ServeContent takes care of
+// range requests, so players can seek within large files.
+func (h *Library) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, library.URLPrefix)
+	if !library.IsMedia(name) || hasHiddenPart(name) {
+		apperrors.Write(w, r, apperrors.NotFound("Media file not found"))
+		return
+	}
+
+	file, err := h.Root.Open("/" + name)
+	if err != nil {
+		apperrors.Write(w, r, apperrors.NotFound("Media file not found"))
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		apperrors.Write(w, r, apperrors.NotFound("Media file not found"))
+		return
+	}
+
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), file)
+}
+
+// hasHiddenPart reports whether any part of the slash separated path starts
+// with a dot, like a hidden folder or "..".
+func hasHiddenPart(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
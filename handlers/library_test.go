@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServeMedia(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"Movies/film.mp4", "Movies/notes.txt", "Movies/.hidden.mp4", ".secret/film.mp4", "couchtube.db"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("media"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := NewLibraryHandler(root)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{name: "media file", method: http.MethodGet, path: "/media/Movies/film.mp4", want: http.StatusOK},
+		{name: "head of a media file", method: http.MethodHead, path: "/media/Movies/film.mp4", want: http.StatusOK},
+		{name: "missing media file", method: http.MethodGet, path: "/media/Movies/other.mkv", want: http.StatusNotFound},
+		{name: "file without a media extension", method: http.MethodGet, path: "/media/Movies/notes.txt", want: http.StatusNotFound},
+		{name: "database beside the library", method: http.MethodGet, path: "/media/couchtube.db", want: http.StatusNotFound},
+		{name: "hidden file", method: http.MethodGet, path: "/media/Movies/.hidden.mp4", want: http.StatusNotFound},
+		{name: "hidden folder", method: http.MethodGet, path: "/media/.secret/film.mp4", want: http.StatusNotFound},
+		{name: "parent folder", method: http.MethodGet, path: "/media/../film.mp4", want: http.StatusNotFound},
+		{name: "folder", method: http.MethodGet, path: "/media/Movies", want: http.StatusNotFound},
+		{name: "method", method: http.MethodPost, path: "/media/Movies/film.mp4", want: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(test.method, "/", nil)
+			request.URL.Path = test.path
+			handler.ServeMedia(recorder, request)
+
+			if recorder.Code != test.want {
+				t.Errorf("got status %d, want %d", recorder.Code, test.want)
+			}
+			if test.want == http.StatusNotFound && recorder.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("got content type %q, want a JSON error", recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+const (
+	devicePrefix = "ctd_"
+	// deviceCookieTTL is how long a browser keeps its device token, and
+	// with it its lineup preferences, after it last loaded its lineup.
+	deviceCookieTTL = 400 * 24 * time.Hour
+)
+
+// Lineup returns the channels of the caller's lineup the way they arranged
+// them, including hidden ones, or replaces their arrangement on PUT.
+// Browsers without a sign-in get a device cookie to keep it under, which is
+// renewed whenever they load it.
+func (h *Media) Lineup(w http.ResponseWriter, r *http.Request) {
+	var (
+		lineup jsonmodels.LineupJson
+		err    error
+	)
+
+	identity := auth.FromContext(r.Context())
+	anonymous := identity == nil || identity.UserID == 0
+	if device := auth.DeviceFromContext(r.Context()); anonymous && device != "" {
+		http.SetCookie(w, deviceCookie(r, device))
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		lineup, err = h.Service.FetchLineup(r.Context())
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to load lineup", err)
+			return
+		}
+	case http.MethodPut:
+		var request jsonmodels.LineupJson
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apperrors.Write(w, r, apperrors.Validation("Request body is not valid JSON").WithDetails(map[string]interface{}{"reason": err.Error()}))
+			return
+		}
+
+		if anonymous && auth.DeviceFromContext(r.Context()) == "" {
+			token := auth.NewSecret(devicePrefix)
+			http.SetCookie(w, deviceCookie(r, token))
+			r = r.WithContext(auth.WithDevice(r.Context(), token))
+		}
+
+		lineup, err = h.Service.SaveLineup(r.Context(), request)
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to save lineup", err)
+			return
+		}
+	default:
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(lineup)
+}
+
+// deviceCookie returns the device cookie. Like the session cookie, it is
+// kept from scripts and cross-site requests.
+func deviceCookie(r *http.Request, token string) *http.Cookie {
+	return &http.Cookie{
+		Name:     auth.DeviceCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(deviceCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	}
+}
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/config"
+	"github.com/ozencb/couchtube/helpers"
+	"github.com/ozencb/couchtube/metrics"
 	dbmodels "github.com/ozencb/couchtube/models/db"
 	jsonmodels "github.com/ozencb/couchtube/models/json"
 	"github.com/ozencb/couchtube/services"
@@ -13,21 +16,22 @@ import (
 
 type Media struct {
 	Service *services.MediaService
+	Config  *config.Config
 }
 
-func NewMediaHandler(service *services.MediaService) *Media {
-	return &Media{Service: service}
+func NewMediaHandler(service *services.MediaService, cfg *config.Config) *Media {
+	return &Media{Service: service, Config: cfg}
 }
 
 func (h *Media) FetchAllChannels(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
 		return
 	}
 
-	channels, err := h.Service.FetchAllChannels()
+	channels, err := h.Service.FetchAllChannels(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to load channels", http.StatusInternalServerError)
+		writeError(w, r, h.Service.Logger, "Failed to load channels", err)
 		return
 	}
 
@@ -38,42 +42,48 @@ func (h *Media) FetchAllChannels(w http.ResponseWriter, r *http.Request) {
 
 func (h *Media) GetCurrentVideo(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
 		return
 	}
 
-	channelID := r.URL.Query().Get("channel-id")
-	if channelID == "" {
-		http.Error(w, "channel-id is required", http.StatusBadRequest)
+	// channel takes a slug, channel number or ID; channel-id is kept for
+	// older clients
+	channelRef := r.URL.Query().Get("channel")
+	if channelRef == "" {
+		channelRef = r.URL.Query().Get("channel-id")
+	}
+	if channelRef == "" {
+		apperrors.Write(w, r, apperrors.Validation("channel is required"))
 		return
 	}
-	channelIDInt, err := strconv.Atoi(channelID)
+	channel, err := h.Service.FindChannel(r.Context(), channelRef)
 	if err != nil {
-		http.Error(w, "Invalid channel-id", http.StatusBadRequest)
+		writeError(w, r, h.Service.Logger, "Failed to load channel", err)
 		return
 	}
+	metrics.CurrentVideoLookups.WithLabelValues(channel.Slug).Inc()
 
+	entryID := r.URL.Query().Get("entry-id")
+	// video-id is kept for older clients, which sent the video that just
+	// played before entries were told apart
 	videoID := r.URL.Query().Get("video-id")
 
-	var video *dbmodels.Video
-	// if videoId is provided, call FetchNextVideo
-	if videoID != "" {
-		videoIDInt, err := strconv.Atoi(videoID)
+	var video *dbmodels.ChannelVideo
+	// if entryId is provided, call FetchNextVideo
+	if entryID != "" {
+		entryIDInt, err := strconv.Atoi(entryID)
 		if err != nil {
-			http.Error(w, "Invalid video-id", http.StatusBadRequest)
+			apperrors.Write(w, r, apperrors.Validation("Invalid entry-id"))
 			return
 		}
-		video = h.Service.FetchNextVideo(channelIDInt, videoIDInt)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{"video": video})
-		return
+		video = h.Service.FetchNextVideo(r.Context(), channel, entryIDInt)
+	} else if videoID != "" {
+		video = h.Service.FetchNextVideoAfter(r.Context(), channel, videoID)
 	} else {
-		// if videoId is not provided, call GetCurrentVideoByChannelId
-		video, err = h.Service.GetCurrentVideoByChannelId(channelIDInt)
+		// if entryId is not provided, call GetCurrentVideoByChannelId
+		video, err = h.Service.GetCurrentVideo(r.Context(), channel)
 		if err != nil {
-			println(err.Error())
-			http.Error(w, "Failed to load video", http.StatusInternalServerError)
+			writeError(w, r, h.Service.Logger, "Failed to load video", err)
 			return
 		}
 	}
@@ -85,51 +95,67 @@ func (h *Media) GetCurrentVideo(w http.ResponseWriter, r *http.Request) {
 
 func (h *Media) InvalidateVideo(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
 		return
 	}
 
 	videoID := r.URL.Query().Get("video-id")
 	if videoID == "" {
-		http.Error(w, "video-id is required", http.StatusBadRequest)
+		apperrors.Write(w, r, apperrors.Validation("video-id is required"))
 		return
 	}
 
-	err := h.Service.InvalidateVideo(videoID)
+	var errorCode *int
+	if value := r.URL.Query().Get("error-code"); value != "" {
+		code, err := strconv.Atoi(value)
+		if err != nil {
+			apperrors.Write(w, r, apperrors.Validation("Invalid error-code"))
+			return
+		}
+		errorCode = &code
+	}
+
+	reporter := helpers.Fingerprint(helpers.ClientIP(r, h.Config.ClientIPHeader, h.Config.TrustedProxies))
+
+	quarantined, err := h.Service.InvalidateVideo(r.Context(), videoID, reporter, errorCode)
 	if err != nil {
-		http.Error(w, "Failed to invalidate video", http.StatusInternalServerError)
+		writeError(w, r, h.Service.Logger, "Failed to invalidate video", err)
 		return
 	}
 
-	log.Default().Println("Video invalidated: ", videoID)
+	if quarantined {
+		h.Service.Logger.InfoContext(r.Context(), "Video quarantined", "video_id", videoID)
+	} else {
+		h.Service.Logger.InfoContext(r.Context(), "Video reported", "video_id", videoID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "quarantined": quarantined})
 
 }
 
 func (h *Media) SubmitList(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
 		return
 	}
 
 	var list jsonmodels.SubmitListRequestJson
 	err := json.NewDecoder(r.Body).Decode(&list)
 	if err != nil {
-		http.Error(w, "Failed to parse list", http.StatusBadRequest)
+		apperrors.Write(w, r, apperrors.Validation("Request body is not valid JSON").WithDetails(map[string]interface{}{"reason": err.Error()}))
 		return
 	}
 
 	if list.VideoListUrl == "" {
-		http.Error(w, "videoListUrl is required", http.StatusBadRequest)
+		apperrors.Write(w, r, apperrors.Validation("videoListUrl is required"))
 		return
 	}
 
-	success, err := h.Service.SubmitList(list)
+	success, err := h.Service.SubmitList(r.Context(), list)
 	if err != nil {
-		http.Error(w, "Failed to submit list", http.StatusInternalServerError)
+		writeError(w, r, h.Service.Logger, "Failed to submit list", err)
 		return
 	}
 
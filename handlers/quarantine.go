@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ozencb/couchtube/apperrors"
+)
+
+func (h *Media) FetchQuarantinedVideos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	videos, err := h.Service.FetchQuarantinedVideos(r.Context())
+	if err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to load quarantined videos", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"videos": videos})
+}
+
+func (h *Media) RestoreVideo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	videoID := r.URL.Query().Get("video-id")
+	if videoID == "" {
+		apperrors.Write(w, r, apperrors.Validation("video-id is required"))
+		return
+	}
+
+	err := h.Service.RestoreVideo(r.Context(), videoID)
+	if err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to restore video", err)
+		return
+	}
+
+	h.Service.Logger.InfoContext(r.Context(), "Video restored", "video_id", videoID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+func (h *Media) PurgeVideo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	videoID := r.URL.Query().Get("video-id")
+	if videoID == "" {
+		apperrors.Write(w, r, apperrors.Validation("video-id is required"))
+		return
+	}
+
+	err := h.Service.PurgeVideo(r.Context(), videoID)
+	if err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to purge video", err)
+		return
+	}
+
+	h.Service.Logger.InfoContext(r.Context(), "Video purged", "video_id", videoID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ozencb/couchtube/apperrors"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+	"github.com/ozencb/couchtube/services"
+)
+
+type Users struct {
+	Service *services.AuthService
+	Media   *services.MediaService
+}
+
+func NewUsersHandler(service *services.AuthService, media *services.MediaService) *Users {
+	return &Users{Service: service, Media: media}
+}
+
+// Users lists users on GET, creates or updates a user on POST and deletes
+// the user in ?name= on DELETE.
+func (h *Users) Users(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := h.Service.ListUsers(r.Context())
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to load users", err)
+			return
+		}
+
+		list := make([]map[string]interface{}, 0, len(users))
+		for _, user := range users {
+			list = append(list, map[string]interface{}{
+				"id":        user.ID,
+				"name":      user.Name,
+				"role":      user.Role,
+				"password":  user.PasswordHash != "",
+				"maxRating": user.MaxRating,
+				"pin":       user.PinHash != "",
+				"createdAt": user.CreatedAt,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"users": list})
+	case http.MethodPost:
+		var request jsonmodels.UserRequestJson
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apperrors.Write(w, r, apperrors.Validation("Request body is not valid JSON").WithDetails(map[string]interface{}{"reason": err.Error()}))
+			return
+		}
+
+		created, err := h.Service.SaveUser(r.Context(), request)
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to save user", err)
+			return
+		}
+
+		h.Service.Logger.InfoContext(r.Context(), "User saved", "user", request.Name, "created", created)
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "created": created})
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			apperrors.Write(w, r, apperrors.Validation("name is required"))
+			return
+		}
+
+		if err := h.Service.DeleteUser(r.Context(), name); err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to delete user", err)
+			return
+		}
+
+		h.Service.Logger.InfoContext(r.Context(), "User deleted", "user", name)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	default:
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+	}
+}
+
+// ChannelOwner gives a channel to a user, so they may edit it as a curator.
+func (h *Users) ChannelOwner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apperrors.Write(w, r, apperrors.MethodNotAllowed())
+		return
+	}
+
+	var request jsonmodels.ChannelOwnerRequestJson
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apperrors.Write(w, r, apperrors.Validation("Request body is not valid JSON").WithDetails(map[string]interface{}{"reason": err.Error()}))
+		return
+	}
+	if request.Channel == "" {
+		apperrors.Write(w, r, apperrors.Validation("channel is required"))
+		return
+	}
+
+	var ownerID *int
+	if request.Owner != "" {
+		owner, err := h.Service.FindUser(r.Context(), request.Owner)
+		if err != nil {
+			writeError(w, r, h.Service.Logger, "Failed to load user", err)
+			return
+		}
+		ownerID = &owner.ID
+	}
+
+	if err := h.Media.SetChannelOwner(r.Context(), request.Channel, ownerID); err != nil {
+		writeError(w, r, h.Service.Logger, "Failed to set channel owner", err)
+		return
+	}
+
+	h.Service.Logger.InfoContext(r.Context(), "Channel owner set", "channel", request.Channel, "owner", request.Owner)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/db/dialect"
+	"github.com/ozencb/couchtube/db/migrations"
+	repo "github.com/ozencb/couchtube/repositories"
+	"github.com/ozencb/couchtube/services"
+	_ "modernc.org/sqlite"
+)
+
+// newTestDB returns an empty, migrated SQLite database.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	database, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "couchtube.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	migrator, err := migrations.NewMigrator(database, dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	return database
+}
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestUsersSaveIsAllOrNothing(t *testing.T) {
+	database := newTestDB(t)
+	users := repo.NewUserRepository(database, dialect.SQLite, testLogger)
+	service := services.NewAuthService(repo.NewAuthRepository(database, dialect.SQLite, testLogger), users, "", time.Hour, nil, testLogger)
+	handler := NewUsersHandler(service, nil)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(body))
+		r = r.WithContext(auth.WithIdentity(r.Context(), &auth.Identity{Name: "admin", Role: auth.RoleAdmin, Method: auth.MethodSession}))
+		w := httptest.NewRecorder()
+		handler.Users(w, r)
+		return w
+	}
+
+	if w := post(`{"name": "parents", "role": "curator"}`); w.Code != http.StatusCreated {
+		t.Fatalf("creating parents gave %d: %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "new user with a bad PIN", body: `{"name": "kids", "role": "viewer", "maxRating": "PG", "pin": "12"}`},
+		{name: "new user with a bad rating", body: `{"name": "kids", "pin": "1234", "maxRating": "PG-99"}`},
+		{name: "new user with a bad role", body: `{"name": "kids", "role": "owner", "pin": "1234"}`},
+		{name: "existing user with a bad PIN", body: `{"name": "parents", "role": "admin", "password": "secret", "maxRating": "R", "pin": "abcd"}`},
+		{name: "existing user with a bad rating", body: `{"name": "parents", "role": "admin", "pin": "1234", "maxRating": "X"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := post(test.body); w.Code != http.StatusBadRequest {
+				t.Fatalf("got %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+
+			kids, err := users.FindUserByName(context.Background(), "kids")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kids != nil {
+				t.Errorf("kids was created: %+v", kids)
+			}
+
+			parents, err := users.FindUserByName(context.Background(), "parents")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parents.Role != string(auth.RoleCurator) || parents.PasswordHash != "" || parents.MaxRating != "" || parents.PinHash != "" {
+				t.Errorf("parents was changed: %+v", parents)
+			}
+		})
+	}
+
+	if w := post(`{"name": "kids", "maxRating": "PG", "pin": "1234"}`); w.Code != http.StatusCreated {
+		t.Fatalf("creating kids gave %d: %s", w.Code, w.Body)
+	}
+	kids, err := users.FindUserByName(context.Background(), "kids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kids.Role != string(auth.RoleViewer) || kids.MaxRating != "PG" || kids.PinHash == "" {
+		t.Errorf("kids was created as %+v, want a PG viewer with a PIN", kids)
+	}
+}
@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client that sent the request. When
+// the request came from one of trustedProxies, trustedHeader is read
+// instead, since a reverse proxy in front of the server hides the original
+// address from RemoteAddr. Clients can send the header themselves, so it is
+// never read for requests from anywhere else.
+func ClientIP(r *http.Request, trustedHeader string, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if trustedHeader == "" || err != nil || !containsAddr(trustedProxies, remote) {
+		return host
+	}
+
+	// Proxies append the address they got the request from, so the client
+	// is the rightmost entry that isn't one of the proxies. Entries to the
+	// left of it came from the client and can't be trusted.
+	entries := strings.Split(strings.Join(r.Header.Values(trustedHeader), ","), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(entries[i])
+		if entry == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			break
+		}
+		if !containsAddr(trustedProxies, addr.Unmap()) {
+			return addr.Unmap().String()
+		}
+	}
+
+	return host
+}
+
+// ParseNetworks parses a comma separated list of IP addresses and CIDR
+// ranges, like "10.0.0.0/8, 192.168.1.2".
+func ParseNetworks(value string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			networks = append(networks, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a CIDR range", entry)
+		}
+		networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return networks, nil
+}
+
+func containsAddr(networks []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint hashes a client identifier so it can be stored without keeping
+// the identifier itself.
+func Fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
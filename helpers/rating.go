@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ratingAges maps the MPA film ratings to the age they are suitable from.
+var ratingAges = map[string]int{
+	"G":     0,
+	"PG":    8,
+	"PG-13": 13,
+	"R":     17,
+	"NC-17": 18,
+}
+
+// NormalizeRating turns a content rating into its canonical form, one of
+// G, PG, PG-13, R and NC-17 or an age like "12", and reports whether it is
+// valid.
+func NormalizeRating(rating string) (string, bool) {
+	rating = strings.ToUpper(strings.TrimSpace(rating))
+	if _, known := ratingAges[rating]; known {
+		return rating, true
+	}
+
+	age, err := strconv.Atoi(rating)
+	if err != nil || age < 0 || age > 99 {
+		return "", false
+	}
+	return strconv.Itoa(age), true
+}
+
+// RatingAge returns the age a content rating is suitable from. Empty and
+// unknown ratings are suitable for everyone.
+func RatingAge(rating string) int {
+	rating, ok := NormalizeRating(rating)
+	if !ok {
+		return 0
+	}
+	if age, known := ratingAges[rating]; known {
+		return age
+	}
+	age, _ := strconv.Atoi(rating)
+	return age
+}
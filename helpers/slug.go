@@ -0,0 +1,47 @@
+package helpers
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	slugPattern          = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	channelNumberPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+)
+
+// Slugify turns a name into a lowercase, dash separated slug. Slugs that
+// would only be digits get a "channel-" prefix so they can't be mistaken for
+// a channel number or ID.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	slug := b.String()
+	if slug == "" || channelNumberPattern.MatchString(slug) {
+		return strings.TrimSuffix("channel-"+slug, "-")
+	}
+	return slug
+}
+
+// IsValidSlug reports whether slug is made of lowercase letters, digits and
+// single dashes, and is not just a number.
+func IsValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug) && !channelNumberPattern.MatchString(slug)
+}
+
+// IsValidChannelNumber accepts numbers like "5" or "12.1".
+func IsValidChannelNumber(number string) bool {
+	return channelNumberPattern.MatchString(number)
+}
@@ -0,0 +1,106 @@
+package library
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+// URLPrefix is the route local media files are served from.
+const URLPrefix = "/media/"
+
+var mediaExtensions = map[string]bool{
+	".mp4":  true,
+	".m4v":  true,
+	".mov":  true,
+	".webm": true,
+	".mkv":  true,
+}
+
+// IsMedia reports whether name is a file the library plays: one with a media
+// extension that isn't hidden.
+func IsMedia(name string) bool {
+	base := path.Base(filepath.ToSlash(name))
+	return !strings.HasPrefix(base, ".") && mediaExtensions[strings.ToLower(path.Ext(base))]
+}
+
+// Scan builds a channel for every subfolder of root, holding the media files
+// found directly inside it in name order. Files that can't be probed are
+// skipped.
+func Scan(root string, prober Prober) (jsonmodels.ChannelsJson, error) {
+	var channels jsonmodels.ChannelsJson
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return channels, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		channel, err := scanChannel(root, entry.Name(), prober)
+		if err != nil {
+			return channels, err
+		}
+		if len(channel.Videos) == 0 {
+			slog.Warn("Media folder has no playable files. Skipping.", "folder", entry.Name())
+			continue
+		}
+
+		channels.Channels = append(channels.Channels, channel)
+	}
+
+	return channels, nil
+}
+
+func scanChannel(root, folder string, prober Prober) (jsonmodels.ChannelJson, error) {
+	channel := jsonmodels.ChannelJson{Name: folder}
+
+	files, err := os.ReadDir(filepath.Join(root, folder))
+	if err != nil {
+		return channel, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	for _, file := range files {
+		if file.IsDir() || !IsMedia(file.Name()) {
+			continue
+		}
+
+		duration, err := prober.Probe(filepath.Join(root, folder, file.Name()))
+		if err != nil {
+			slog.Warn("Failed to probe media file", "path", folder+"/"+file.Name(), "error", err)
+			continue
+		}
+		if int(duration.Seconds()) <= 0 {
+			continue
+		}
+
+		relativePath := path.Join(folder, file.Name())
+		channel.Videos = append(channel.Videos, jsonmodels.VideoJson{
+			Id:           videoID(relativePath),
+			Source:       dbmodels.VideoSourceLocal,
+			Url:          URLPrefix + url.PathEscape(folder) + "/" + url.PathEscape(file.Name()),
+			SectionStart: 0,
+			SectionEnd:   int(duration.Seconds()),
+		})
+	}
+
+	return channel, nil
+}
+
+func videoID(relativePath string) string {
+	sum := sha1.Sum([]byte(relativePath))
+	return dbmodels.VideoSourceLocal + "-" + hex.EncodeToString(sum[:])[:16]
+}
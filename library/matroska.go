@@ -0,0 +1,167 @@
+package library
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	ebmlHeaderID    = 0x1A45DFA3
+	segmentID       = 0x18538067
+	segmentInfoID   = 0x1549A966
+	timecodeScaleID = 0x2AD7B1
+	durationID      = 0x4489
+	clusterID       = 0x1F43B675
+
+	defaultTimecodeScale = 1000000
+)
+
+// matroskaDuration reads the Duration element of the Segment Info of a
+// Matroska or WebM file.
+func matroskaDuration(r io.ReadSeeker) (time.Duration, error) {
+	id, size, err := readElementHeader(r)
+	if err != nil {
+		return 0, err
+	}
+	if id != ebmlHeaderID {
+		return 0, errors.New("not an EBML file")
+	}
+	if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+		return 0, err
+	}
+
+	id, _, err = readElementHeader(r)
+	if err != nil {
+		return 0, err
+	}
+	if id != segmentID {
+		return 0, errors.New("no Matroska segment found")
+	}
+
+	// The segment size may be unknown for live recordings, so walk its
+	// children until Info turns up instead of relying on it.
+	for {
+		id, size, err := readElementHeader(r)
+		if err != nil {
+			return 0, err
+		}
+		switch id {
+		case segmentInfoID:
+			return readSegmentInfoDuration(r, size)
+		case clusterID:
+			return 0, errors.New("segment info not found before media data")
+		}
+		if size < 0 {
+			return 0, errors.New("element of unknown size found before segment info")
+		}
+		if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func readSegmentInfoDuration(r io.ReadSeeker, size int64) (time.Duration, error) {
+	timecodeScale := uint64(defaultTimecodeScale)
+	duration := -1.0
+
+	for remaining := size; remaining > 0; {
+		start, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+
+		id, elementSize, err := readElementHeader(r)
+		if err != nil {
+			return 0, err
+		}
+		data := make([]byte, elementSize)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 0, err
+		}
+
+		switch id {
+		case timecodeScaleID:
+			timecodeScale = 0
+			for _, b := range data {
+				timecodeScale = timecodeScale<<8 | uint64(b)
+			}
+		case durationID:
+			switch len(data) {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(data))
+			default:
+				return 0, errors.New("invalid duration element")
+			}
+		}
+
+		end, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		remaining -= end - start
+	}
+
+	if duration < 0 {
+		return 0, errors.New("segment info has no duration")
+	}
+
+	return time.Duration(duration * float64(timecodeScale)), nil
+}
+
+// readElementHeader reads an EBML element ID and data size. Unknown sizes are
+// returned as -1.
+func readElementHeader(r io.Reader) (uint64, int64, error) {
+	id, _, err := readVint(r, false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size, unknown, err := readVint(r, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	if unknown {
+		return id, -1, nil
+	}
+
+	return id, int64(size), nil
+}
+
+// readVint reads an EBML variable length integer. IDs keep their length
+// marker bits while sizes have them stripped.
+func readVint(r io.Reader, stripMarker bool) (uint64, bool, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return 0, false, err
+	}
+
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, false, errors.New("invalid EBML variable length integer")
+	}
+
+	value := uint64(first[0])
+	if stripMarker {
+		value &= uint64(0xFF >> length)
+	}
+	allOnes := value == uint64(0xFF>>length)
+
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return 0, false, err
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+
+	return value, stripMarker && allOnes, nil
+}
@@ -0,0 +1,108 @@
+package library
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// mp4Duration reads the movie duration from the mvhd box inside moov.
+func mp4Duration(r io.ReadSeeker) (time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	moovStart, moovEnd, err := findBox(r, 0, end, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhdStart, _, err := findBox(r, moovStart, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := r.Seek(mvhdStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var versionAndFlags [4]byte
+	if _, err := io.ReadFull(r, versionAndFlags[:]); err != nil {
+		return 0, err
+	}
+
+	var timescale uint32
+	var duration uint64
+	if versionAndFlags[0] == 1 {
+		var header struct {
+			Created   uint64
+			Modified  uint64
+			Timescale uint32
+			Duration  uint64
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return 0, err
+		}
+		timescale, duration = header.Timescale, header.Duration
+	} else {
+		var header struct {
+			Created   uint32
+			Modified  uint32
+			Timescale uint32
+			Duration  uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return 0, err
+		}
+		timescale, duration = header.Timescale, uint64(header.Duration)
+	}
+
+	if timescale == 0 {
+		return 0, errors.New("mvhd box has no timescale")
+	}
+
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
+
+// findBox looks for a box of the given type among the boxes between start
+// and end, returning where its payload starts and ends.
+func findBox(r io.ReadSeeker, start, end int64, boxType string) (int64, int64, error) {
+	offset := start
+	for offset+8 <= end {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return 0, 0, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// the box extends to the end of the file
+			size = end - offset
+		case 1:
+			var largeSize uint64
+			if err := binary.Read(r, binary.BigEndian, &largeSize); err != nil {
+				return 0, 0, err
+			}
+			size = int64(largeSize)
+			headerSize = 16
+		}
+		if size < headerSize {
+			return 0, 0, fmt.Errorf("invalid %s box size %d", header[4:], size)
+		}
+
+		if string(header[4:]) == boxType {
+			return offset + headerSize, offset + size, nil
+		}
+		offset += size
+	}
+
+	return 0, 0, fmt.Errorf("no %s box found", boxType)
+}
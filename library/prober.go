@@ -0,0 +1,75 @@
+package library
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prober reports how long a media file plays for.
+type Prober interface {
+	Probe(path string) (time.Duration, error)
+}
+
+// NewProber returns the prober registered under name. An empty name selects
+// the metadata prober.
+func NewProber(name string) (Prober, error) {
+	switch name {
+	case "", "metadata":
+		return MetadataProber{}, nil
+	case "ffprobe":
+		return FFProbeProber{Path: "ffprobe"}, nil
+	default:
+		return nil, fmt.Errorf("unknown media prober %q", name)
+	}
+}
+
+// MetadataProber reads the duration stored in the container metadata of MP4
+// and Matroska/WebM files without decoding any media.
+type MetadataProber struct{}
+
+func (MetadataProber) Probe(path string) (time.Duration, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".m4v", ".mov":
+		return mp4Duration(file)
+	case ".webm", ".mkv":
+		return matroskaDuration(file)
+	default:
+		return 0, fmt.Errorf("unsupported container %s", filepath.Ext(path))
+	}
+}
+
+// FFProbeProber shells out to ffprobe, which understands far more formats
+// than MetadataProber at the cost of an external dependency.
+type FFProbeProber struct {
+	Path string
+}
+
+func (p FFProbeProber) Probe(path string) (time.Duration, error) {
+	out, err := exec.Command(p.Path,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %s: %w", path, err)
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %s: unexpected duration %q", path, out)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,77 @@
+// Package logging sets up the structured logger and carries request IDs
+// through contexts, so every line logged while serving a request can be
+// traced back to it.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type contextKey struct{}
+
+// New creates a logger writing lines in format, either "text" or "json",
+// that are at least as severe as level: debug, info, warn or error.
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, use debug, info, warn or error", level)
+	}
+	options := &slog.HandlerOptions{Level: minLevel}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, use text or json", format)
+	}
+
+	return slog.New(requestIDHandler{handler}), nil
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey{}).(string)
+	return requestID
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDHandler adds the request ID from the context, if any, to every
+// record logged with one of the *Context methods.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,117 @@
+// Package metrics holds the Prometheus metrics CouchTube exposes on
+// /metrics, along with the Go runtime and process metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "couchtube"
+
+var (
+	// HTTPRequests and HTTPRequestDuration are recorded by
+	// middleware.Metrics for every registered route.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	CurrentVideoLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "current_video_lookups_total",
+		Help:      "Lookups of the video on air by channel slug.",
+	}, []string{"channel"})
+
+	// Invalidations counts reports of unplayable videos by what they led
+	// to: "reported" when the video stays on air, "quarantined" when the
+	// report took it off air and "already_quarantined".
+	Invalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "video_invalidations_total",
+		Help:      "Reports of unplayable videos by result.",
+	}, []string{"result"})
+
+	ImportDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "import_duration_seconds",
+		Help:      "Time taken to import channels, by kind: list or library.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"kind"})
+
+	ImportFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "import_failures_total",
+		Help:      "Failed channel imports by kind: list or library.",
+	}, []string{"kind"})
+
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time taken by database queries by repository operation.",
+		Buckets:   []float64{.0005, .001, .005, .01, .05, .1, .5, 1, 5},
+	}, []string{"operation"})
+
+	WorkerUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_up",
+		Help:      "Whether a background worker is running.",
+	}, []string{"worker"})
+
+	WorkerRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_runs_total",
+		Help:      "Runs of background workers by result: success or failure.",
+	}, []string{"worker", "result"})
+
+	WorkerLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful run of a background worker.",
+	}, []string{"worker"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveQuery starts timing a database operation. Call the returned
+// function when it is done, typically with defer.
+func ObserveQuery(operation string) func() {
+	start := time.Now()
+	return func() {
+		QueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveImport records the duration of an import, and counts it as failed
+// if err is not nil.
+func ObserveImport(kind string, start time.Time, err error) {
+	ImportDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	if err != nil {
+		ImportFailures.WithLabelValues(kind).Inc()
+	}
+}
+
+// ObserveWorkerRun records the result of one run of a background worker.
+func ObserveWorkerRun(worker string, err error) {
+	if err != nil {
+		WorkerRuns.WithLabelValues(worker, "failure").Inc()
+		return
+	}
+	WorkerRuns.WithLabelValues(worker, "success").Inc()
+	WorkerLastSuccess.WithLabelValues(worker).SetToCurrentTime()
+}
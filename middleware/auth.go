@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+)
+
+// Access is what a route requires of the requests it serves.
+type Access int
+
+const (
+	// Public routes are open to everyone and don't change anything.
+	Public Access = iota
+	// PublicWrite routes are open to everyone, like reporting a broken
+	// video, but change data and are closed in read-only mode.
+	PublicWrite
+	// Curator routes need a curator or admin, like editing owned channels
+	// and triaging reported videos. Like every route that isn't Public, they
+	// are closed to changes in read-only mode.
+	Curator
+	// Admin routes need an admin, like imports, backups and managing users.
+	// API tokens are admins.
+	Admin
+)
+
+// role returns the role a route with this access requires, or "" for routes
+// open to everyone.
+func (a Access) role() auth.Role {
+	switch a {
+	case Curator:
+		return auth.RoleCurator
+	case Admin:
+		return auth.RoleAdmin
+	default:
+		return ""
+	}
+}
+
+// Authenticator resolves the credentials sent with a request.
+type Authenticator interface {
+	AuthenticateToken(ctx context.Context, token string) (*auth.Identity, error)
+	AuthenticateSession(ctx context.Context, sessionID string) (*auth.Identity, error)
+}
+
+// Authenticate looks up the API token in the Authorization header, or the
+// session cookie, of every request and carries the identity in the request
+// context, along with the device cookie. A token that isn't valid is
+// rejected right away, while an expired session just leaves the request
+// anonymous.
+func Authenticate(authenticator Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			identity *auth.Identity
+			err      error
+		)
+
+		if header := r.Header.Get("Authorization"); header != "" {
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found {
+				apperrors.Write(w, r, apperrors.Unauthenticated("Authorization must be a Bearer token"))
+				return
+			}
+			identity, err = authenticator.AuthenticateToken(r.Context(), token)
+		} else if cookie, cookieErr := r.Cookie(auth.SessionCookie); cookieErr == nil {
+			identity, err = authenticator.AuthenticateSession(r.Context(), cookie.Value)
+		}
+		if err != nil {
+			e := apperrors.From(err, "Failed to authenticate")
+			if e.Status() >= http.StatusInternalServerError {
+				slog.ErrorContext(r.Context(), "Failed to authenticate", "error", err)
+			}
+			apperrors.Write(w, r, e)
+			return
+		}
+
+		if identity != nil {
+			r = r.WithContext(auth.WithIdentity(r.Context(), identity))
+		}
+		if cookie, err := r.Cookie(auth.DeviceCookie); err == nil && cookie.Value != "" {
+			r = r.WithContext(auth.WithDevice(r.Context(), cookie.Value))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Require rejects requests to Curator and Admin routes that aren't
+// authenticated, or whose role doesn't include the one the route needs.
+// Services check roles again, along with what the user owns.
+func Require(access Access, next http.HandlerFunc) http.HandlerFunc {
+	role := access.role()
+	if role == "" {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := auth.Require(r.Context(), role); err != nil {
+			apperrors.Write(w, r, apperrors.From(err, "Failed to authorize"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/ozencb/couchtube/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the IDs taken over from clients or proxies, so they
+// can't inject anything into logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID gives every request an ID, keeping one set by a proxy in the
+// X-Request-ID header. The ID is sent back in the same header and carried
+// in the request context for logging.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = logging.NewRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), requestID)))
+	})
+}
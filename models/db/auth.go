@@ -0,0 +1,21 @@
+package dbmodels
+
+// APIToken is an admin API token. The token itself is only shown when it is
+// created; the database keeps its hash.
+type APIToken struct {
+	ID         int    `db:"id" json:"id"`
+	Name       string `db:"name" json:"name"`
+	TokenHash  string `db:"token_hash" json:"-"`
+	CreatedAt  int64  `db:"created_at" json:"createdAt"`
+	LastUsedAt *int64 `db:"last_used_at" json:"lastUsedAt,omitempty"`
+}
+
+// Session is a web UI login, stored by the hash of the ID in its cookie.
+// Sessions without a user are sign-ins with the admin password.
+type Session struct {
+	IDHash    string `db:"id_hash" json:"-"`
+	UserID    *int   `db:"user_id" json:"userId,omitempty"`
+	Name      string `db:"name" json:"name"`
+	CreatedAt int64  `db:"created_at" json:"createdAt"`
+	ExpiresAt int64  `db:"expires_at" json:"expiresAt"`
+}
@@ -1,6 +1,27 @@
 package dbmodels
 
+const (
+	ChannelSourceList    = "list"
+	ChannelSourceLibrary = "library"
+	// ChannelSourceCurated channels are made by curators in the web UI and
+	// left alone by imports.
+	ChannelSourceCurated = "curated"
+)
+
 type Channel struct {
-	ID   int    `db:"id" json:"id"`
-	Name string `db:"name" json:"name"`
+	ID     int    `db:"id" json:"id"`
+	Slug   string `db:"slug" json:"slug"`
+	Number string `db:"number" json:"number,omitempty"`
+	Name   string `db:"name" json:"name"`
+	Rating string `db:"rating" json:"rating,omitempty"`
+	Source string `db:"source" json:"-"`
+	// OwnerID is the user who may edit the channel besides admins, if any.
+	OwnerID *int `db:"owner_id" json:"ownerId,omitempty"`
+	// ProfileID is the user whose personal lineup the channel is in, or nil
+	// for channels of the shared lineup.
+	ProfileID *int `db:"profile_id" json:"profileId,omitempty"`
+	// Favorite and Hidden are how the viewer the channel is listed for
+	// arranged it. They aren't stored with the channel.
+	Favorite bool `db:"-" json:"favorite,omitempty"`
+	Hidden   bool `db:"-" json:"hidden,omitempty"`
 }
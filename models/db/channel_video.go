@@ -0,0 +1,15 @@
+package dbmodels
+
+// ChannelVideo is a single entry in a channel's lineup: a section of a video
+// played at a given position. The same video can appear in several entries.
+type ChannelVideo struct {
+	EntryID      int `db:"id" json:"entryId"`
+	ChannelID    int `db:"channel_id" json:"-"`
+	Position     int `db:"position" json:"position"`
+	SectionStart int `db:"section_start" json:"sectionStart"`
+	SectionEnd   int `db:"section_end" json:"sectionEnd"`
+	// Rating is the content rating of the entry, if it has its own rather
+	// than the one of its channel.
+	Rating string `db:"rating" json:"rating,omitempty"`
+	Video
+}
@@ -0,0 +1,16 @@
+package dbmodels
+
+// LineupPreference is how a viewer arranges one channel of the lineup they
+// watch. It belongs to a user, or to a browser without a sign-in.
+type LineupPreference struct {
+	ID int `db:"id" json:"-"`
+	// UserID is the user the preference belongs to, or nil for a device.
+	UserID *int `db:"user_id" json:"-"`
+	// DeviceHash is the hash of the device token of a browser without a
+	// sign-in, or empty for a user.
+	DeviceHash string `db:"device_hash" json:"-"`
+	ChannelID  int    `db:"channel_id" json:"-"`
+	Position   int    `db:"position" json:"position"`
+	Favorite   bool   `db:"favorite" json:"favorite"`
+	Hidden     bool   `db:"hidden" json:"hidden"`
+}
@@ -0,0 +1,17 @@
+package dbmodels
+
+// User is someone who signs in to the web UI, with a password or through an
+// OpenID Connect provider.
+type User struct {
+	ID   int    `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+	Role string `db:"role" json:"role"`
+	// PasswordHash is empty for users who can't sign in with a password.
+	PasswordHash string `db:"password_hash" json:"-"`
+	// MaxRating is the highest content rating the user may watch, or empty
+	// for no limit.
+	MaxRating string `db:"max_rating" json:"maxRating,omitempty"`
+	// PinHash is empty for users who can be switched to without a PIN.
+	PinHash   string `db:"pin_hash" json:"-"`
+	CreatedAt int64  `db:"created_at" json:"createdAt"`
+}
@@ -1,7 +1,26 @@
 package dbmodels
 
+const (
+	VideoStatusActive      = "active"
+	VideoStatusQuarantined = "quarantined"
+)
+
+const (
+	VideoSourceYouTube = "youtube"
+	VideoSourceDirect  = "direct"
+	VideoSourceHLS     = "hls"
+	VideoSourceLocal   = "local"
+	// VideoSourceFiller stands in for entries above the max rating of a
+	// profile. It is never stored.
+	VideoSourceFiller = "filler"
+)
+
 type Video struct {
-	ID           string `db:"id" json:"id"`
-	SectionStart int    `db:"section_start" json:"sectionStart"`
-	SectionEnd   int    `db:"section_end" json:"sectionEnd"`
+	ID             string `db:"id" json:"id"`
+	Source         string `db:"source" json:"source"`
+	URL            string `db:"url" json:"url,omitempty"`
+	Status         string `db:"status" json:"status,omitempty"`
+	ReportCount    int    `db:"report_count" json:"reportCount,omitempty"`
+	LastReportedAt *int64 `db:"last_reported_at" json:"lastReportedAt,omitempty"`
+	LastErrorCode  *int   `db:"last_error_code" json:"lastErrorCode,omitempty"`
 }
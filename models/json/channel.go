@@ -0,0 +1,36 @@
+package jsonmodels
+
+import (
+	"fmt"
+
+	"github.com/ozencb/couchtube/helpers"
+)
+
+// Normalize derives a slug from the channel name when none is given, checks
+// that the slug and channel number can be used in URLs and puts the rating
+// in its canonical form.
+func (c *ChannelJson) Normalize() error {
+	if c.Name == "" {
+		return fmt.Errorf("channel is missing a name")
+	}
+
+	if c.Slug == "" {
+		c.Slug = helpers.Slugify(c.Name)
+	} else if !helpers.IsValidSlug(c.Slug) {
+		return fmt.Errorf("channel %s has invalid slug %q", c.Name, c.Slug)
+	}
+
+	if c.Number != "" && !helpers.IsValidChannelNumber(c.Number.String()) {
+		return fmt.Errorf("channel %s has invalid number %q", c.Name, c.Number)
+	}
+
+	if c.Rating != "" {
+		rating, ok := helpers.NormalizeRating(string(c.Rating))
+		if !ok {
+			return fmt.Errorf("channel %s has unknown rating %q", c.Name, c.Rating)
+		}
+		c.Rating = Rating(rating)
+	}
+
+	return nil
+}
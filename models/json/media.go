@@ -1,20 +1,105 @@
 package jsonmodels
 
+import "encoding/json"
+
 type VideoJson struct {
 	Id           string `json:"id"`
+	Source       string `json:"source,omitempty"`
+	Url          string `json:"url,omitempty"`
 	SectionStart int    `json:"sectionStart"`
 	SectionEnd   int    `json:"sectionEnd"`
+	Rating       Rating `json:"rating,omitempty"`
 }
 
 type ChannelJson struct {
 	Name   string      `json:"name"`
+	Slug   string      `json:"slug,omitempty"`
+	Number json.Number `json:"number,omitempty"`
+	Rating Rating      `json:"rating,omitempty"`
 	Videos []VideoJson `json:"videos"`
 }
 
+// Rating is a content rating like "PG-13", or an age given as a string or a
+// number.
+type Rating string
+
+func (r *Rating) UnmarshalJSON(data []byte) error {
+	var rating string
+	if err := json.Unmarshal(data, &rating); err == nil {
+		*r = Rating(rating)
+		return nil
+	}
+
+	var age json.Number
+	if err := json.Unmarshal(data, &age); err != nil {
+		return err
+	}
+	*r = Rating(age)
+	return nil
+}
+
 type ChannelsJson struct {
 	Channels []ChannelJson `json:"channels"`
 }
 
 type SubmitListRequestJson struct {
 	VideoListUrl string `json:"videoListUrl"`
+	// Profile is the user whose lineup the list replaces, or empty for the
+	// shared lineup.
+	Profile string `json:"profile,omitempty"`
+}
+
+// LoginRequestJson signs in as the user Name, or with the admin password
+// when Name is empty.
+type LoginRequestJson struct {
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password"`
+}
+
+// ChannelVideoRequestJson adds a video to the channel with the slug, number
+// or ID in Channel.
+type ChannelVideoRequestJson struct {
+	Channel string `json:"channel"`
+	VideoJson
+}
+
+// UserRequestJson creates or updates a user. Empty fields of existing users
+// are left alone.
+type UserRequestJson struct {
+	Name     string `json:"name"`
+	Role     string `json:"role,omitempty"`
+	Password string `json:"password,omitempty"`
+	// MaxRating and Pin are only changed when they are given, and removed
+	// when they are empty.
+	MaxRating *string `json:"maxRating,omitempty"`
+	Pin       *string `json:"pin,omitempty"`
+}
+
+// ProfileRequestJson switches to the viewer profile Name, with its PIN if
+// it is locked.
+type ProfileRequestJson struct {
+	Name string `json:"name"`
+	Pin  string `json:"pin,omitempty"`
+}
+
+// ChannelOwnerRequestJson gives Channel to the user named Owner, or takes it
+// from its owner when Owner is empty.
+type ChannelOwnerRequestJson struct {
+	Channel string `json:"channel"`
+	Owner   string `json:"owner"`
+}
+
+// LineupChannelJson is how a viewer arranged the channel with the slug,
+// number or ID in Channel. Name and Number are only filled in responses.
+type LineupChannelJson struct {
+	Channel  string `json:"channel"`
+	Name     string `json:"name,omitempty"`
+	Number   string `json:"number,omitempty"`
+	Favorite bool   `json:"favorite"`
+	Hidden   bool   `json:"hidden"`
+}
+
+// LineupJson lists the channels of a lineup in the order a viewer put them.
+type LineupJson struct {
+	Channels []LineupChannelJson `json:"channels"`
 }
@@ -0,0 +1,57 @@
+package jsonmodels
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ozencb/couchtube/helpers"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+)
+
+// Normalize fills in defaults for optional fields and checks that the video
+// can be played. Videos without a source are YouTube videos, and videos
+// hosted elsewhere get an ID derived from their URL if they don't have one.
+func (v *VideoJson) Normalize() error {
+	if v.Source == "" {
+		v.Source = dbmodels.VideoSourceYouTube
+	}
+
+	switch v.Source {
+	case dbmodels.VideoSourceYouTube:
+		if v.Id == "" {
+			return fmt.Errorf("youtube video is missing an id")
+		}
+	case dbmodels.VideoSourceDirect, dbmodels.VideoSourceHLS:
+		parsed, err := url.Parse(v.Url)
+		if err != nil || v.Url == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("%s video %q needs an http(s) url", v.Source, v.Id)
+		}
+		if v.Id == "" {
+			sum := sha1.Sum([]byte(v.Url))
+			v.Id = v.Source + "-" + hex.EncodeToString(sum[:])[:16]
+		}
+	case dbmodels.VideoSourceLocal:
+		if v.Id == "" || !strings.HasPrefix(v.Url, "/media/") {
+			return fmt.Errorf("local video %q needs an id and a /media/ url", v.Id)
+		}
+	default:
+		return fmt.Errorf("video %q has unknown source %q", v.Id, v.Source)
+	}
+
+	if v.SectionEnd <= v.SectionStart {
+		return fmt.Errorf("video %q ends before it starts", v.Id)
+	}
+
+	if v.Rating != "" {
+		rating, ok := helpers.NormalizeRating(string(v.Rating))
+		if !ok {
+			return fmt.Errorf("video %q has unknown rating %q", v.Id, v.Rating)
+		}
+		v.Rating = Rating(rating)
+	}
+
+	return nil
+}
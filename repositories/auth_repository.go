@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/db/dialect"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+)
+
+type AuthRepository interface {
+	SaveToken(ctx context.Context, token dbmodels.APIToken) (int, error)
+	FetchTokens(ctx context.Context) ([]dbmodels.APIToken, error)
+	FindTokenByHash(ctx context.Context, tokenHash string) (*dbmodels.APIToken, error)
+	TouchToken(ctx context.Context, id int, usedAt int64) error
+	DeleteToken(ctx context.Context, ref string) error
+	SaveSession(ctx context.Context, session dbmodels.Session) error
+	FindSession(ctx context.Context, idHash string, now int64) (*dbmodels.Session, error)
+	DeleteSession(ctx context.Context, idHash string) error
+	DeleteExpiredSessions(ctx context.Context, now int64) error
+}
+
+type authRepository struct {
+	db      *sql.DB
+	dialect dialect.Dialect
+	logger  *slog.Logger
+}
+
+func NewAuthRepository(db *sql.DB, sqlDialect dialect.Dialect, logger *slog.Logger) AuthRepository {
+	return &authRepository{db: db, dialect: sqlDialect, logger: logger}
+}
+
+// SaveToken stores a new token and returns its ID. Token names are unique.
+func (r *authRepository) SaveToken(ctx context.Context, token dbmodels.APIToken) (int, error) {
+	defer observeQuery(ctx, r.logger, "save_token")()
+
+	var id int
+	err := r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+        INSERT INTO api_tokens (name, token_hash, created_at) VALUES (?, ?, ?)
+        ON CONFLICT(name) DO NOTHING
+        RETURNING id
+    `), token.Name, token.TokenHash, token.CreatedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, apperrors.Conflict("A token with this name already exists").WithDetails(map[string]interface{}{"name": token.Name})
+	}
+
+	return id, err
+}
+
+func (r *authRepository) FetchTokens(ctx context.Context) ([]dbmodels.APIToken, error) {
+	defer observeQuery(ctx, r.logger, "fetch_tokens")()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, created_at, last_used_at FROM api_tokens ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []dbmodels.APIToken
+	for rows.Next() {
+		var token dbmodels.APIToken
+		if err := rows.Scan(&token.ID, &token.Name, &token.CreatedAt, &token.LastUsedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// FindTokenByHash returns the token with the given hash, or nil if there is
+// none.
+func (r *authRepository) FindTokenByHash(ctx context.Context, tokenHash string) (*dbmodels.APIToken, error) {
+	defer observeQuery(ctx, r.logger, "find_token")()
+
+	var token dbmodels.APIToken
+	err := r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+        SELECT id, name, created_at, last_used_at FROM api_tokens WHERE token_hash = ?
+    `), tokenHash).Scan(&token.ID, &token.Name, &token.CreatedAt, &token.LastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *authRepository) TouchToken(ctx context.Context, id int, usedAt int64) error {
+	defer observeQuery(ctx, r.logger, "touch_token")()
+
+	_, err := r.db.ExecContext(ctx, r.dialect.Rebind(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`), usedAt, id)
+	return err
+}
+
+// DeleteToken revokes the token with the given name or ID.
+func (r *authRepository) DeleteToken(ctx context.Context, ref string) error {
+	defer observeQuery(ctx, r.logger, "delete_token")()
+
+	result, err := r.db.ExecContext(ctx, r.dialect.Rebind(`
+        DELETE FROM api_tokens WHERE name = ? OR CAST(id AS TEXT) = ?
+    `), ref, ref)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return apperrors.NotFound("Token not found").WithDetails(map[string]interface{}{"token": ref})
+	}
+
+	return nil
+}
+
+func (r *authRepository) SaveSession(ctx context.Context, session dbmodels.Session) error {
+	defer observeQuery(ctx, r.logger, "save_session")()
+
+	_, err := r.db.ExecContext(ctx, r.dialect.Rebind(`
+        INSERT INTO sessions (id_hash, user_id, name, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
+    `), session.IDHash, session.UserID, session.Name, session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+// FindSession returns the session with the given ID hash, or nil if there
+// is none or it expired before now.
+func (r *authRepository) FindSession(ctx context.Context, idHash string, now int64) (*dbmodels.Session, error) {
+	defer observeQuery(ctx, r.logger, "find_session")()
+
+	session := dbmodels.Session{IDHash: idHash}
+	err := r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+        SELECT user_id, name, created_at, expires_at FROM sessions WHERE id_hash = ? AND expires_at > ?
+    `), idHash, now).Scan(&session.UserID, &session.Name, &session.CreatedAt, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (r *authRepository) DeleteSession(ctx context.Context, idHash string) error {
+	defer observeQuery(ctx, r.logger, "delete_session")()
+
+	_, err := r.db.ExecContext(ctx, r.dialect.Rebind(`DELETE FROM sessions WHERE id_hash = ?`), idHash)
+	return err
+}
+
+func (r *authRepository) DeleteExpiredSessions(ctx context.Context, now int64) error {
+	defer observeQuery(ctx, r.logger, "delete_expired_sessions")()
+
+	_, err := r.db.ExecContext(ctx, r.dialect.Rebind(`DELETE FROM sessions WHERE expires_at <= ?`), now)
+	return err
+}
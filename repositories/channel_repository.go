@@ -1,39 +1,61 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
+	"strings"
 
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/db/dialect"
 	dbmodels "github.com/ozencb/couchtube/models/db"
 )
 
 type ChannelRepository interface {
-	FetchAllChannels() ([]dbmodels.Channel, error)
-	InsertChannel(tx *sql.Tx, channelName string) (int, error)
-	DeleteAllChannels(tx *sql.Tx) error
+	FetchAllChannels(ctx context.Context, profileID int) ([]dbmodels.Channel, error)
+	FetchChannels(ctx context.Context, tx *sql.Tx) ([]dbmodels.Channel, error)
+	FindChannel(ctx context.Context, profileID int, ref string) (*dbmodels.Channel, error)
+	HasChannels(ctx context.Context, tx *sql.Tx) (bool, error)
+	HasLineup(ctx context.Context, profileID int) (bool, error)
+	SaveChannel(ctx context.Context, tx *sql.Tx, channel dbmodels.Channel) (int, error)
+	CreateChannel(ctx context.Context, tx *sql.Tx, channel dbmodels.Channel) (int, error)
+	UpdateChannel(ctx context.Context, tx *sql.Tx, channel dbmodels.Channel) error
+	DeleteChannelsBySource(ctx context.Context, tx *sql.Tx, source string, keep []string) error
+	DeleteChannel(ctx context.Context, tx *sql.Tx, channelID int) error
+	SetChannelOwner(ctx context.Context, channelID int, ownerID *int) error
 }
 
 type channelRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect.Dialect
+	logger  *slog.Logger
 }
 
-func NewChannelRepository(db *sql.DB) ChannelRepository {
-	return &channelRepository{db: db}
+func NewChannelRepository(db *sql.DB, sqlDialect dialect.Dialect, logger *slog.Logger) ChannelRepository {
+	return &channelRepository{db: db, dialect: sqlDialect, logger: logger}
 }
 
 func (r *channelRepository) BeginTx() (*sql.Tx, error) {
 	return r.db.Begin()
 }
 
-func (r *channelRepository) FetchAllChannels() ([]dbmodels.Channel, error) {
+// FetchAllChannels returns the channels of the lineup of profileID, or of
+// the shared lineup when it is 0, that have something to play, in channel
+// number order. Channels without a number come last.
+func (r *channelRepository) FetchAllChannels(ctx context.Context, profileID int) ([]dbmodels.Channel, error) {
+	defer observeQuery(ctx, r.logger, "fetch_all_channels")()
+
 	query := `
-    SELECT id, name
+    SELECT id, COALESCE(slug, ''), COALESCE(number, ''), name, COALESCE(rating, '')
     FROM channels
-    WHERE EXISTS (
+    WHERE COALESCE(profile_id, 0) = ? AND EXISTS (
         SELECT 1 FROM channel_videos
-        WHERE channel_videos.channel_id = channels.id
-    );`
+        JOIN videos ON videos.id = channel_videos.video_id
+        WHERE channel_videos.channel_id = channels.id AND videos.status = 'active'
+    )
+    ORDER BY number IS NULL, CAST(number AS REAL), id;`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(query), profileID)
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +64,7 @@ func (r *channelRepository) FetchAllChannels() ([]dbmodels.Channel, error) {
 	var channels []dbmodels.Channel
 	for rows.Next() {
 		var channel dbmodels.Channel
-		if err := rows.Scan(&channel.ID, &channel.Name); err != nil {
+		if err := rows.Scan(&channel.ID, &channel.Slug, &channel.Number, &channel.Name, &channel.Rating); err != nil {
 			return nil, err
 		}
 		channels = append(channels, channel)
@@ -51,27 +73,191 @@ func (r *channelRepository) FetchAllChannels() ([]dbmodels.Channel, error) {
 	return channels, rows.Err()
 }
 
-func (r *channelRepository) InsertChannel(tx *sql.Tx, channelName string) (int, error) {
-	exec := r.db.Exec
+// FetchChannels returns every channel of every lineup, whether or not it
+// has anything to play.
+func (r *channelRepository) FetchChannels(ctx context.Context, tx *sql.Tx) ([]dbmodels.Channel, error) {
+	defer observeQuery(ctx, r.logger, "fetch_channels")()
+
+	query := r.db.QueryContext
 	if tx != nil {
-		exec = tx.Exec
+		query = tx.QueryContext
 	}
 
-	result, err := exec("INSERT INTO channels (name) VALUES (?) RETURNING id", channelName)
+	rows, err := query(ctx, `SELECT id, COALESCE(slug, ''), COALESCE(number, ''), name, COALESCE(rating, ''), source, owner_id, profile_id FROM channels ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []dbmodels.Channel
+	for rows.Next() {
+		var channel dbmodels.Channel
+		if err := rows.Scan(&channel.ID, &channel.Slug, &channel.Number, &channel.Name, &channel.Rating, &channel.Source, &channel.OwnerID, &channel.ProfileID); err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
+
+// FindChannel looks a channel of the lineup of profileID, or of the shared
+// lineup when it is 0, up by its slug, its channel number or its ID, in that
+// order.
+func (r *channelRepository) FindChannel(ctx context.Context, profileID int, ref string) (*dbmodels.Channel, error) {
+	defer observeQuery(ctx, r.logger, "find_channel")()
+
+	var channel dbmodels.Channel
+	err := r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+        SELECT id, COALESCE(slug, ''), COALESCE(number, ''), name, COALESCE(rating, ''), source, owner_id, profile_id
+        FROM channels
+        WHERE COALESCE(profile_id, 0) = ? AND (slug = ? OR number = ? OR CAST(id AS TEXT) = ?)
+        ORDER BY CASE WHEN slug = ? THEN 0 WHEN number = ? THEN 1 ELSE 2 END
+        LIMIT 1
+    `), profileID, ref, ref, ref, ref, ref).Scan(&channel.ID, &channel.Slug, &channel.Number, &channel.Name, &channel.Rating, &channel.Source, &channel.OwnerID, &channel.ProfileID)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.NotFound("Channel not found").WithDetails(map[string]interface{}{"channel": ref})
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	return &channel, nil
+}
+
+func (r *channelRepository) HasChannels(ctx context.Context, tx *sql.Tx) (bool, error) {
+	defer observeQuery(ctx, r.logger, "has_channels")()
+
+	queryRow := r.db.QueryRowContext
+	if tx != nil {
+		queryRow = tx.QueryRowContext
+	}
+
+	var exists bool
+	err := queryRow(ctx, `SELECT EXISTS(SELECT 1 FROM channels)`).Scan(&exists)
+	return exists, err
+}
+
+// HasLineup reports whether the user profileID has a personal lineup.
+func (r *channelRepository) HasLineup(ctx context.Context, profileID int) (bool, error) {
+	defer observeQuery(ctx, r.logger, "has_lineup")()
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, r.dialect.Rebind(`SELECT EXISTS(SELECT 1 FROM channels WHERE profile_id = ?)`), profileID).Scan(&exists)
+	return exists, err
+}
+
+// SaveChannel creates a channel in the lineup of channel.ProfileID, or
+// updates the channel with the same name and source in that lineup, and
+// returns its ID. An empty slug or number keeps the one the channel already
+// has. A channel with the same name but another source is never taken over.
+func (r *channelRepository) SaveChannel(ctx context.Context, tx *sql.Tx, channel dbmodels.Channel) (int, error) {
+	defer observeQuery(ctx, r.logger, "save_channel")()
+
+	queryRow := r.db.QueryRowContext
+	if tx != nil {
+		queryRow = tx.QueryRowContext
+	}
+
+	var id int
+	err := queryRow(ctx, r.dialect.Rebind(`
+        INSERT INTO channels (name, source, slug, number, rating, profile_id) VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?)
+        ON CONFLICT ((COALESCE(profile_id, 0)), name) DO UPDATE
+        SET rating = excluded.rating,
+            slug = COALESCE(excluded.slug, channels.slug),
+            number = COALESCE(excluded.number, channels.number)
+        WHERE channels.source = excluded.source
+        RETURNING id
+    `), channel.Name, channel.Source, channel.Slug, channel.Number, channel.Rating, channel.ProfileID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, apperrors.Conflict("A channel with this name already exists").WithDetails(map[string]interface{}{"name": channel.Name})
+	}
+
+	return id, err
+}
+
+// CreateChannel creates a channel owned by channel.OwnerID in the lineup of
+// channel.ProfileID and returns its ID. Unlike SaveChannel, it never takes
+// over an existing channel.
+func (r *channelRepository) CreateChannel(ctx context.Context, tx *sql.Tx, channel dbmodels.Channel) (int, error) {
+	defer observeQuery(ctx, r.logger, "create_channel")()
+
+	queryRow := r.db.QueryRowContext
+	if tx != nil {
+		queryRow = tx.QueryRowContext
+	}
+
+	var id int
+	err := queryRow(ctx, r.dialect.Rebind(`
+        INSERT INTO channels (name, source, slug, number, rating, owner_id, profile_id) VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?)
+        ON CONFLICT DO NOTHING
+        RETURNING id
+    `), channel.Name, channel.Source, channel.Slug, channel.Number, channel.Rating, channel.OwnerID, channel.ProfileID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, apperrors.Conflict("A channel with this name, slug or number already exists").WithDetails(map[string]interface{}{"name": channel.Name})
+	}
+
+	return id, err
+}
+
+// UpdateChannel sets the name, slug, number and rating of an existing
+// channel. An empty slug, number or rating clears it.
+func (r *channelRepository) UpdateChannel(ctx context.Context, tx *sql.Tx, channel dbmodels.Channel) error {
+	defer observeQuery(ctx, r.logger, "update_channel")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
 	}
 
-	id, err := result.LastInsertId()
-	return int(id), err
+	_, err := exec(ctx, r.dialect.Rebind(`
+        UPDATE channels
+        SET name = ?, slug = NULLIF(?, ''), number = NULLIF(?, ''), rating = NULLIF(?, '')
+        WHERE id = ?
+    `), channel.Name, channel.Slug, channel.Number, channel.Rating, channel.ID)
+	return err
 }
 
-func (r *channelRepository) DeleteAllChannels(tx *sql.Tx) error {
-	exec := r.db.Exec
+// DeleteChannelsBySource removes the channels of the shared lineup that came
+// from source, except for the ones named in keep.
+func (r *channelRepository) DeleteChannelsBySource(ctx context.Context, tx *sql.Tx, source string, keep []string) error {
+	defer observeQuery(ctx, r.logger, "delete_channels_by_source")()
+
+	exec := r.db.ExecContext
 	if tx != nil {
-		exec = tx.Exec
+		exec = tx.ExecContext
 	}
 
-	_, err := exec("DELETE FROM channels")
+	query := "DELETE FROM channels WHERE profile_id IS NULL AND source = ?"
+	args := []interface{}{source}
+	if len(keep) > 0 {
+		query += " AND name NOT IN (?" + strings.Repeat(", ?", len(keep)-1) + ")"
+		for _, name := range keep {
+			args = append(args, name)
+		}
+	}
+
+	_, err := exec(ctx, r.dialect.Rebind(query), args...)
+	return err
+}
+
+func (r *channelRepository) DeleteChannel(ctx context.Context, tx *sql.Tx, channelID int) error {
+	defer observeQuery(ctx, r.logger, "delete_channel")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
+	}
+
+	_, err := exec(ctx, r.dialect.Rebind("DELETE FROM channels WHERE id = ?"), channelID)
+	return err
+}
+
+// SetChannelOwner gives a channel to the user ownerID, or takes it from its
+// owner when ownerID is nil.
+func (r *channelRepository) SetChannelOwner(ctx context.Context, channelID int, ownerID *int) error {
+	defer observeQuery(ctx, r.logger, "set_channel_owner")()
+
+	_, err := r.db.ExecContext(ctx, r.dialect.Rebind("UPDATE channels SET owner_id = ? WHERE id = ?"), ownerID, channelID)
 	return err
 }
@@ -0,0 +1,20 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ozencb/couchtube/metrics"
+)
+
+// observeQuery starts timing a repository operation, recording it as a
+// metric and a debug log line once the returned function is called.
+func observeQuery(ctx context.Context, logger *slog.Logger, operation string) func() {
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		metrics.QueryDuration.WithLabelValues(operation).Observe(elapsed.Seconds())
+		logger.DebugContext(ctx, "Query finished", "operation", operation, "duration", elapsed)
+	}
+}
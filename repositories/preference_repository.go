@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/ozencb/couchtube/db/dialect"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+)
+
+// PreferenceRepository stores how viewers arrange the channels of their
+// lineup. A viewer is the user userID, or when it is 0, the browser whose
+// device token hashes to deviceHash.
+type PreferenceRepository interface {
+	FetchPreferences(ctx context.Context, userID int, deviceHash string, profileID int) ([]dbmodels.LineupPreference, error)
+	ReplacePreferences(ctx context.Context, tx *sql.Tx, userID int, deviceHash string, profileID int, preferences []dbmodels.LineupPreference) error
+}
+
+type preferenceRepository struct {
+	db      *sql.DB
+	dialect dialect.Dialect
+	logger  *slog.Logger
+}
+
+func NewPreferenceRepository(db *sql.DB, sqlDialect dialect.Dialect, logger *slog.Logger) PreferenceRepository {
+	return &preferenceRepository{db: db, dialect: sqlDialect, logger: logger}
+}
+
+// FetchPreferences returns the preferences of a viewer for the channels of
+// the lineup of profileID, or of the shared lineup when it is 0, in the
+// viewer's order.
+func (r *preferenceRepository) FetchPreferences(ctx context.Context, userID int, deviceHash string, profileID int) ([]dbmodels.LineupPreference, error) {
+	defer observeQuery(ctx, r.logger, "fetch_preferences")()
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(`
+        SELECT lineup_preferences.id, lineup_preferences.channel_id, lineup_preferences.position,
+            lineup_preferences.favorite, lineup_preferences.hidden
+        FROM lineup_preferences
+        JOIN channels ON channels.id = lineup_preferences.channel_id
+        WHERE COALESCE(lineup_preferences.user_id, 0) = ? AND COALESCE(lineup_preferences.device_hash, '') = ?
+            AND COALESCE(channels.profile_id, 0) = ?
+        ORDER BY lineup_preferences.position
+    `), userID, deviceHash, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var preferences []dbmodels.LineupPreference
+	for rows.Next() {
+		preference := dbmodels.LineupPreference{DeviceHash: deviceHash}
+		if userID != 0 {
+			preference.UserID = &userID
+		}
+		if err := rows.Scan(&preference.ID, &preference.ChannelID, &preference.Position, &preference.Favorite, &preference.Hidden); err != nil {
+			return nil, err
+		}
+		preferences = append(preferences, preference)
+	}
+
+	return preferences, rows.Err()
+}
+
+// ReplacePreferences replaces the preferences of a viewer for the channels
+// of the lineup of profileID with preferences. Their preferences for other
+// lineups are left alone.
+func (r *preferenceRepository) ReplacePreferences(ctx context.Context, tx *sql.Tx, userID int, deviceHash string, profileID int, preferences []dbmodels.LineupPreference) error {
+	defer observeQuery(ctx, r.logger, "replace_preferences")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
+	}
+
+	_, err := exec(ctx, r.dialect.Rebind(`
+        DELETE FROM lineup_preferences
+        WHERE COALESCE(user_id, 0) = ? AND COALESCE(device_hash, '') = ?
+            AND channel_id IN (SELECT id FROM channels WHERE COALESCE(profile_id, 0) = ?)
+    `), userID, deviceHash, profileID)
+	if err != nil {
+		return err
+	}
+
+	for _, preference := range preferences {
+		_, err := exec(ctx, r.dialect.Rebind(`
+            INSERT INTO lineup_preferences (user_id, device_hash, channel_id, position, favorite, hidden)
+            VALUES (NULLIF(?, 0), NULLIF(?, ''), ?, ?, ?, ?)
+        `), userID, deviceHash, preference.ChannelID, preference.Position, preference.Favorite, preference.Hidden)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,9 +1,12 @@
 package repo
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+)
 
 type TxManager interface {
-	BeginTx() (*sql.Tx, error)
+	BeginTx(ctx context.Context) (*sql.Tx, error)
 	GetDB() *sql.DB
 }
 
@@ -15,8 +18,8 @@ func NewTxManager(db *sql.DB) TxManager {
 	return &txManager{db: db}
 }
 
-func (r *txManager) BeginTx() (*sql.Tx, error) {
-	return r.db.Begin()
+func (r *txManager) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, nil)
 }
 
 func (r *txManager) GetDB() *sql.DB {
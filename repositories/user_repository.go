@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/db/dialect"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+)
+
+type UserRepository interface {
+	SaveUser(ctx context.Context, user dbmodels.User) (int, error)
+	UpsertOIDCUser(ctx context.Context, user dbmodels.User, issuer string, subject string) (int, error)
+	FetchUsers(ctx context.Context) ([]dbmodels.User, error)
+	FindUserByName(ctx context.Context, name string) (*dbmodels.User, error)
+	FindUserByID(ctx context.Context, id int) (*dbmodels.User, error)
+	UpdateUser(ctx context.Context, user dbmodels.User) error
+	DeleteUser(ctx context.Context, name string) error
+	HasPasswordUsers(ctx context.Context) (bool, error)
+}
+
+type userRepository struct {
+	db      *sql.DB
+	dialect dialect.Dialect
+	logger  *slog.Logger
+}
+
+func NewUserRepository(db *sql.DB, sqlDialect dialect.Dialect, logger *slog.Logger) UserRepository {
+	return &userRepository{db: db, dialect: sqlDialect, logger: logger}
+}
+
+// SaveUser creates a user and returns their ID. User names are unique.
+// Empty password hashes, max ratings and PIN hashes are stored as none.
+func (r *userRepository) SaveUser(ctx context.Context, user dbmodels.User) (int, error) {
+	defer observeQuery(ctx, r.logger, "save_user")()
+
+	var id int
+	err := r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+        INSERT INTO users (name, role, password_hash, max_rating, pin_hash, created_at) VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?)
+        ON CONFLICT(name) DO NOTHING
+        RETURNING id
+    `), user.Name, user.Role, user.PasswordHash, user.MaxRating, user.PinHash, user.CreatedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, apperrors.Conflict("A user with this name already exists").WithDetails(map[string]interface{}{"name": user.Name})
+	}
+
+	return id, err
+}
+
+// UpsertOIDCUser sets the role of the user who signs in with the OpenID
+// Connect subject of issuer, or creates them with the name of user, and
+// returns their ID. Users are never matched by name, so a new user whose
+// name is taken gets a Conflict error.
+func (r *userRepository) UpsertOIDCUser(ctx context.Context, user dbmodels.User, issuer string, subject string) (int, error) {
+	defer observeQuery(ctx, r.logger, "upsert_oidc_user")()
+
+	var id int
+	err := r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+        UPDATE users SET role = ? WHERE oidc_issuer = ? AND oidc_subject = ?
+        RETURNING id
+    `), user.Role, issuer, subject).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	err = r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+        INSERT INTO users (name, role, created_at, oidc_issuer, oidc_subject) VALUES (?, ?, ?, ?, ?)
+        ON CONFLICT DO NOTHING
+        RETURNING id
+    `), user.Name, user.Role, user.CreatedAt, issuer, subject).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, apperrors.Conflict("A user with this name already exists").WithDetails(map[string]interface{}{"name": user.Name})
+	}
+
+	return id, err
+}
+
+func (r *userRepository) FetchUsers(ctx context.Context) ([]dbmodels.User, error) {
+	defer observeQuery(ctx, r.logger, "fetch_users")()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, role, COALESCE(password_hash, ''), COALESCE(max_rating, ''), COALESCE(pin_hash, ''), created_at FROM users ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []dbmodels.User
+	for rows.Next() {
+		var user dbmodels.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Role, &user.PasswordHash, &user.MaxRating, &user.PinHash, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// FindUserByName returns the user with the given name, or nil if there is
+// none.
+func (r *userRepository) FindUserByName(ctx context.Context, name string) (*dbmodels.User, error) {
+	defer observeQuery(ctx, r.logger, "find_user")()
+
+	return r.findUser(ctx, `WHERE name = ?`, name)
+}
+
+// FindUserByID returns the user with the given ID, or nil if there is none.
+func (r *userRepository) FindUserByID(ctx context.Context, id int) (*dbmodels.User, error) {
+	defer observeQuery(ctx, r.logger, "find_user")()
+
+	return r.findUser(ctx, `WHERE id = ?`, id)
+}
+
+func (r *userRepository) findUser(ctx context.Context, where string, arg interface{}) (*dbmodels.User, error) {
+	var user dbmodels.User
+	err := r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+        SELECT id, name, role, COALESCE(password_hash, ''), COALESCE(max_rating, ''), COALESCE(pin_hash, ''), created_at FROM users `+where,
+	), arg).Scan(&user.ID, &user.Name, &user.Role, &user.PasswordHash, &user.MaxRating, &user.PinHash, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdateUser sets the role, password hash, max rating and PIN hash of an
+// existing user. An empty password hash turns off sign-in with a password,
+// and an empty max rating or PIN hash removes it.
+func (r *userRepository) UpdateUser(ctx context.Context, user dbmodels.User) error {
+	defer observeQuery(ctx, r.logger, "update_user")()
+
+	_, err := r.db.ExecContext(ctx, r.dialect.Rebind(`
+        UPDATE users
+        SET role = ?, password_hash = NULLIF(?, ''), max_rating = NULLIF(?, ''), pin_hash = NULLIF(?, '')
+        WHERE id = ?
+    `), user.Role, user.PasswordHash, user.MaxRating, user.PinHash, user.ID)
+	return err
+}
+
+// DeleteUser removes a user, ending their sessions. The channels they owned
+// are kept without an owner.
+func (r *userRepository) DeleteUser(ctx context.Context, name string) error {
+	defer observeQuery(ctx, r.logger, "delete_user")()
+
+	result, err := r.db.ExecContext(ctx, r.dialect.Rebind(`DELETE FROM users WHERE name = ?`), name)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return apperrors.NotFound("User not found").WithDetails(map[string]interface{}{"user": name})
+	}
+
+	return nil
+}
+
+// HasPasswordUsers reports whether any user can sign in with a password.
+func (r *userRepository) HasPasswordUsers(ctx context.Context) (bool, error) {
+	defer observeQuery(ctx, r.logger, "has_password_users")()
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE password_hash IS NOT NULL)`).Scan(&exists)
+	return exists, err
+}
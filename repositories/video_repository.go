@@ -1,44 +1,62 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"log/slog"
 
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/db/dialect"
 	dbmodels "github.com/ozencb/couchtube/models/db"
 )
 
 type VideoRepository interface {
-	GetVideosByChannelID(channelID int) ([]dbmodels.Video, error)
-	FetchNextVideo(videoID int, channelID int) (*dbmodels.Video, error)
-	SaveVideo(tx *sql.Tx, channelID int, videoUrl string, sectionStart int, sectionEnd int) error
-	DeleteVideo(tx *sql.Tx, videoID string) error
-	DeleteAllVideos(tx *sql.Tx) error
+	GetVideosByChannelID(ctx context.Context, channelID int) ([]dbmodels.ChannelVideo, error)
+	GetChannelEntries(ctx context.Context, tx *sql.Tx, channelID int) ([]dbmodels.ChannelVideo, error)
+	FetchNextVideo(ctx context.Context, channelID int, entryID int) (*dbmodels.ChannelVideo, error)
+	SaveVideo(ctx context.Context, tx *sql.Tx, channelID int, video dbmodels.Video, sectionStart int, sectionEnd int, rating string) error
+	GetVideoStatus(ctx context.Context, tx *sql.Tx, videoID string) (string, error)
+	SaveReport(ctx context.Context, tx *sql.Tx, videoID string, reporter string, errorCode *int, reportedAt int64) error
+	CountReporters(ctx context.Context, tx *sql.Tx, videoID string, since int64) (int, error)
+	QuarantineVideo(ctx context.Context, tx *sql.Tx, videoID string) error
+	GetQuarantinedVideos(ctx context.Context) ([]dbmodels.Video, error)
+	RestoreVideo(ctx context.Context, tx *sql.Tx, videoID string) error
+	PurgeVideo(ctx context.Context, tx *sql.Tx, videoID string) error
+	DeleteChannelVideos(ctx context.Context, tx *sql.Tx, channelID int) error
+	DeleteEntry(ctx context.Context, tx *sql.Tx, channelID int, entryID int) error
+	DeleteOrphanVideos(ctx context.Context, tx *sql.Tx) (int, error)
 }
 
 type videoRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect.Dialect
+	logger  *slog.Logger
 }
 
-func NewVideoRepository(db *sql.DB) VideoRepository {
-	return &videoRepository{db: db}
+func NewVideoRepository(db *sql.DB, sqlDialect dialect.Dialect, logger *slog.Logger) VideoRepository {
+	return &videoRepository{db: db, dialect: sqlDialect, logger: logger}
 }
 
-func (r *videoRepository) GetVideosByChannelID(channelID int) ([]dbmodels.Video, error) {
-	rows, err := r.db.Query(`
-        SELECT id, section_start, section_end
-        FROM videos
-		JOIN channel_videos ON videos.id = channel_videos.video_id
-		WHERE channel_videos.channel_id = ?
-    `, channelID)
+func (r *videoRepository) GetVideosByChannelID(ctx context.Context, channelID int) ([]dbmodels.ChannelVideo, error) {
+	defer observeQuery(ctx, r.logger, "get_videos_by_channel_id")()
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(`
+        SELECT channel_videos.id, channel_videos.channel_id, channel_videos.position,
+            channel_videos.section_start, channel_videos.section_end, COALESCE(channel_videos.rating, ''), videos.id, videos.source, COALESCE(videos.url, '')
+        FROM channel_videos
+		JOIN videos ON videos.id = channel_videos.video_id
+		WHERE channel_videos.channel_id = ? AND videos.status = 'active'
+		ORDER BY channel_videos.position ASC
+    `), channelID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var videos []dbmodels.Video
+	var videos []dbmodels.ChannelVideo
 	for rows.Next() {
-		var video dbmodels.Video
-		if err := rows.Scan(&video.ID, &video.SectionStart, &video.SectionEnd); err != nil {
+		var video dbmodels.ChannelVideo
+		if err := rows.Scan(&video.EntryID, &video.ChannelID, &video.Position, &video.SectionStart, &video.SectionEnd, &video.Rating, &video.ID, &video.Source, &video.URL); err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
@@ -51,30 +69,72 @@ func (r *videoRepository) GetVideosByChannelID(channelID int) ([]dbmodels.Video,
 	return videos, nil
 }
 
-func (r *videoRepository) FetchNextVideo(videoID int, channelID int) (*dbmodels.Video, error) {
-	row := r.db.QueryRow(`
-		SELECT id, section_start, section_end
-		FROM videos
-		JOIN channel_videos ON videos.id = channel_videos.video_id
-		WHERE channel_videos.channel_id = ? AND videos.id > ?
-		ORDER BY id ASC
+// GetChannelEntries returns a channel's whole lineup in order, including
+// entries whose video is quarantined.
+func (r *videoRepository) GetChannelEntries(ctx context.Context, tx *sql.Tx, channelID int) ([]dbmodels.ChannelVideo, error) {
+	defer observeQuery(ctx, r.logger, "get_channel_entries")()
+
+	query := r.db.QueryContext
+	if tx != nil {
+		query = tx.QueryContext
+	}
+
+	rows, err := query(ctx, r.dialect.Rebind(`
+        SELECT channel_videos.id, channel_videos.channel_id, channel_videos.position,
+            channel_videos.section_start, channel_videos.section_end, COALESCE(channel_videos.rating, ''), videos.id, videos.source, COALESCE(videos.url, ''), videos.status
+        FROM channel_videos
+        JOIN videos ON videos.id = channel_videos.video_id
+        WHERE channel_videos.channel_id = ?
+        ORDER BY channel_videos.position ASC
+    `), channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var videos []dbmodels.ChannelVideo
+	for rows.Next() {
+		var video dbmodels.ChannelVideo
+		if err := rows.Scan(&video.EntryID, &video.ChannelID, &video.Position, &video.SectionStart, &video.SectionEnd, &video.Rating, &video.ID, &video.Source, &video.URL, &video.Status); err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
+// FetchNextVideo returns the entry that follows entryID in the channel's
+// lineup, wrapping around to the first entry after the last one.
+func (r *videoRepository) FetchNextVideo(ctx context.Context, channelID int, entryID int) (*dbmodels.ChannelVideo, error) {
+	defer observeQuery(ctx, r.logger, "fetch_next_video")()
+
+	row := r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+		SELECT channel_videos.id, channel_videos.channel_id, channel_videos.position,
+			channel_videos.section_start, channel_videos.section_end, COALESCE(channel_videos.rating, ''), videos.id, videos.source, COALESCE(videos.url, '')
+		FROM channel_videos
+		JOIN videos ON videos.id = channel_videos.video_id
+		WHERE channel_videos.channel_id = ? AND videos.status = 'active'
+			AND channel_videos.position > (SELECT position FROM channel_videos WHERE id = ?)
+		ORDER BY channel_videos.position ASC
 		LIMIT 1
-	`, channelID, videoID)
+	`), channelID, entryID)
 
-	var video dbmodels.Video
-	err := row.Scan(&video.ID, &video.SectionStart, &video.SectionEnd)
+	var video dbmodels.ChannelVideo
+	err := row.Scan(&video.EntryID, &video.ChannelID, &video.Position, &video.SectionStart, &video.SectionEnd, &video.Rating, &video.ID, &video.Source, &video.URL)
 	if err == sql.ErrNoRows {
 		// If no next video is found, get the first video instead
-		row = r.db.QueryRow(`
-			SELECT id, section_start, section_end
-			FROM videos
-			JOIN channel_videos ON videos.id = channel_videos.video_id
-			WHERE channels.id = ?
-			ORDER BY id ASC
+		row = r.db.QueryRowContext(ctx, r.dialect.Rebind(`
+			SELECT channel_videos.id, channel_videos.channel_id, channel_videos.position,
+				channel_videos.section_start, channel_videos.section_end, COALESCE(channel_videos.rating, ''), videos.id, videos.source, COALESCE(videos.url, '')
+			FROM channel_videos
+			JOIN videos ON videos.id = channel_videos.video_id
+			WHERE channel_videos.channel_id = ? AND videos.status = 'active'
+			ORDER BY channel_videos.position ASC
 			LIMIT 1
-		`, channelID)
+		`), channelID)
 
-		err = row.Scan(&video.ID, &video.SectionStart, &video.SectionEnd)
+		err = row.Scan(&video.EntryID, &video.ChannelID, &video.Position, &video.SectionStart, &video.SectionEnd, &video.Rating, &video.ID, &video.Source, &video.URL)
 		if err != nil {
 			return nil, err
 		}
@@ -85,59 +145,285 @@ func (r *videoRepository) FetchNextVideo(videoID int, channelID int) (*dbmodels.
 	return &video, nil
 }
 
-func (r *videoRepository) SaveVideo(tx *sql.Tx, channelID int, videoId string, sectionStart int, sectionEnd int) error {
-	exec := r.db.Exec
+// SaveVideo appends a section of a video to the end of a channel's lineup,
+// creating the video if it is not known yet. A known video is left as it is,
+// since other channels may play it, and saving it with another source or URL
+// is a conflict. An empty rating leaves the entry with the rating of its
+// channel.
+func (r *videoRepository) SaveVideo(ctx context.Context, tx *sql.Tx, channelID int, video dbmodels.Video, sectionStart int, sectionEnd int, rating string) error {
+	defer observeQuery(ctx, r.logger, "save_video")()
+
+	exec := r.db.ExecContext
+	queryRow := r.db.QueryRowContext
 	if tx != nil {
-		exec = tx.Exec
+		exec = tx.ExecContext
+		queryRow = tx.QueryRowContext
 	}
 
-	_, err := exec(`
-        INSERT OR IGNORE INTO videos (id, section_start, section_end)
-        VALUES (?, ?, ?)
-    `, videoId, sectionStart, sectionEnd)
+	_, err := exec(ctx, r.dialect.Rebind(`
+        INSERT INTO videos (id, source, url)
+        VALUES (?, ?, NULLIF(?, ''))
+        ON CONFLICT(id) DO NOTHING
+    `), video.ID, video.Source, video.URL)
 	if err != nil {
 		return err
 	}
 
-	_, err = exec(`
-        INSERT OR IGNORE INTO channel_videos (channel_id, video_id)
-        VALUES (?, ?)
-    `, channelID, videoId)
+	var source, url string
+	err = queryRow(ctx, r.dialect.Rebind(`SELECT source, COALESCE(url, '') FROM videos WHERE id = ?`), video.ID).Scan(&source, &url)
+	if err != nil {
+		return err
+	}
+	if source != video.Source || url != video.URL {
+		return apperrors.Conflict("A video with this ID already exists with another source or URL").WithDetails(map[string]interface{}{"video_id": video.ID})
+	}
+
+	_, err = exec(ctx, r.dialect.Rebind(`
+        INSERT INTO channel_videos (channel_id, video_id, position, section_start, section_end, rating)
+        VALUES (?, ?, (SELECT COALESCE(MAX(position) + 1, 0) FROM channel_videos WHERE channel_id = ?), ?, ?, NULLIF(?, ''))
+    `), channelID, video.ID, channelID, sectionStart, sectionEnd, rating)
 
 	return err
 }
 
-func (r *videoRepository) DeleteVideo(tx *sql.Tx, videoID string) error {
-	exec := r.db.Exec
+func (r *videoRepository) GetVideoStatus(ctx context.Context, tx *sql.Tx, videoID string) (string, error) {
+	defer observeQuery(ctx, r.logger, "get_video_status")()
+
+	queryRow := r.db.QueryRowContext
 	if tx != nil {
-		exec = tx.Exec
+		queryRow = tx.QueryRowContext
 	}
 
-	result, err := exec(`
-        DELETE FROM videos
+	var status string
+	err := queryRow(ctx, r.dialect.Rebind(`SELECT status FROM videos WHERE id = ?`), videoID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", apperrors.NotFound("Video not found").WithDetails(map[string]interface{}{"video_id": videoID})
+	}
+
+	return status, err
+}
+
+// SaveReport records that a reporter failed to play a video. Repeated
+// reports from the same reporter replace the previous one, so each reporter
+// is only counted once per video.
+func (r *videoRepository) SaveReport(ctx context.Context, tx *sql.Tx, videoID string, reporter string, errorCode *int, reportedAt int64) error {
+	defer observeQuery(ctx, r.logger, "save_report")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
+	}
+
+	_, err := exec(ctx, r.dialect.Rebind(`
+        INSERT INTO video_reports (video_id, reporter, error_code, reported_at)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT(video_id, reporter) DO UPDATE
+        SET error_code = excluded.error_code, reported_at = excluded.reported_at
+    `), videoID, reporter, errorCode, reportedAt)
+	if err != nil {
+		return err
+	}
+
+	result, err := exec(ctx, r.dialect.Rebind(`
+        UPDATE videos
+        SET report_count = report_count + 1, last_reported_at = ?
         WHERE id = ?
-    `, videoID)
+    `), reportedAt, videoID)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return expectRowsAffected(result, videoID, "Video not found")
+}
+
+func (r *videoRepository) CountReporters(ctx context.Context, tx *sql.Tx, videoID string, since int64) (int, error) {
+	defer observeQuery(ctx, r.logger, "count_reporters")()
+
+	queryRow := r.db.QueryRowContext
+	if tx != nil {
+		queryRow = tx.QueryRowContext
+	}
+
+	var count int
+	err := queryRow(ctx, r.dialect.Rebind(`
+        SELECT COUNT(DISTINCT reporter)
+        FROM video_reports
+        WHERE video_id = ? AND reported_at >= ?
+    `), videoID, since).Scan(&count)
+
+	return count, err
+}
+
+func (r *videoRepository) QuarantineVideo(ctx context.Context, tx *sql.Tx, videoID string) error {
+	defer observeQuery(ctx, r.logger, "quarantine_video")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
+	}
+
+	result, err := exec(ctx, r.dialect.Rebind(`
+        UPDATE videos
+        SET status = 'quarantined'
+        WHERE id = ?
+    `), videoID)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("no video found with id %d", videoID)
+
+	return expectRowsAffected(result, videoID, "Video not found")
+}
+
+func (r *videoRepository) GetQuarantinedVideos(ctx context.Context) ([]dbmodels.Video, error) {
+	defer observeQuery(ctx, r.logger, "get_quarantined_videos")()
+
+	rows, err := r.db.QueryContext(ctx, r.dialect.Rebind(`
+        SELECT id, source, COALESCE(url, ''), status, report_count, last_reported_at,
+            (SELECT error_code FROM video_reports
+             WHERE video_reports.video_id = videos.id
+             ORDER BY reported_at DESC
+             LIMIT 1)
+        FROM videos
+        WHERE status = 'quarantined'
+        ORDER BY last_reported_at DESC
+    `))
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	var videos []dbmodels.Video
+	for rows.Next() {
+		var video dbmodels.Video
+		var lastReportedAt sql.NullInt64
+		var lastErrorCode sql.NullInt64
+		if err := rows.Scan(&video.ID, &video.Source, &video.URL, &video.Status, &video.ReportCount, &lastReportedAt, &lastErrorCode); err != nil {
+			return nil, err
+		}
+		if lastReportedAt.Valid {
+			video.LastReportedAt = &lastReportedAt.Int64
+		}
+		if lastErrorCode.Valid {
+			code := int(lastErrorCode.Int64)
+			video.LastErrorCode = &code
+		}
+		videos = append(videos, video)
+	}
+
+	return videos, rows.Err()
+}
+
+func (r *videoRepository) RestoreVideo(ctx context.Context, tx *sql.Tx, videoID string) error {
+	defer observeQuery(ctx, r.logger, "restore_video")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
+	}
+
+	result, err := exec(ctx, r.dialect.Rebind(`
+        UPDATE videos
+        SET status = 'active', report_count = 0, last_reported_at = NULL
+        WHERE id = ? AND status = 'quarantined'
+    `), videoID)
+	if err != nil {
+		return err
+	}
+
+	if err := expectRowsAffected(result, videoID, "Quarantined video not found"); err != nil {
+		return err
+	}
+
+	// Start counting reporters from scratch once a video is back on air
+	_, err = exec(ctx, r.dialect.Rebind(`DELETE FROM video_reports WHERE video_id = ?`), videoID)
+	return err
+}
+
+// PurgeVideo permanently removes a quarantined video, cascading to every
+// channel it belongs to.
+func (r *videoRepository) PurgeVideo(ctx context.Context, tx *sql.Tx, videoID string) error {
+	defer observeQuery(ctx, r.logger, "purge_video")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
+	}
+
+	result, err := exec(ctx, r.dialect.Rebind(`
+        DELETE FROM videos
+        WHERE id = ? AND status = 'quarantined'
+    `), videoID)
+	if err != nil {
+		return err
+	}
+
+	return expectRowsAffected(result, videoID, "Quarantined video not found")
 }
 
-func (r *videoRepository) DeleteAllVideos(tx *sql.Tx) error {
-	exec := r.db.Exec
+func (r *videoRepository) DeleteChannelVideos(ctx context.Context, tx *sql.Tx, channelID int) error {
+	defer observeQuery(ctx, r.logger, "delete_channel_videos")()
+
+	exec := r.db.ExecContext
 	if tx != nil {
-		exec = tx.Exec
+		exec = tx.ExecContext
 	}
 
-	_, err := exec("DELETE FROM videos")
+	_, err := exec(ctx, r.dialect.Rebind("DELETE FROM channel_videos WHERE channel_id = ?"), channelID)
 	return err
 }
+
+// DeleteEntry removes a single entry from a channel's lineup.
+func (r *videoRepository) DeleteEntry(ctx context.Context, tx *sql.Tx, channelID int, entryID int) error {
+	defer observeQuery(ctx, r.logger, "delete_entry")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
+	}
+
+	result, err := exec(ctx, r.dialect.Rebind("DELETE FROM channel_videos WHERE channel_id = ? AND id = ?"), channelID, entryID)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return apperrors.NotFound("Entry not found").WithDetails(map[string]interface{}{"entry_id": entryID})
+	}
+
+	return nil
+}
+
+// DeleteOrphanVideos removes videos that no longer appear in any channel and
+// returns how many were removed.
+func (r *videoRepository) DeleteOrphanVideos(ctx context.Context, tx *sql.Tx) (int, error) {
+	defer observeQuery(ctx, r.logger, "delete_orphan_videos")()
+
+	exec := r.db.ExecContext
+	if tx != nil {
+		exec = tx.ExecContext
+	}
+
+	result, err := exec(ctx, r.dialect.Rebind("DELETE FROM videos WHERE id NOT IN (SELECT video_id FROM channel_videos)"))
+	if err != nil {
+		return 0, err
+	}
+
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+// expectRowsAffected returns a not found error with message if result didn't
+// touch any rows.
+func expectRowsAffected(result sql.Result, videoID string, message string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return apperrors.NotFound(message).WithDetails(map[string]interface{}{"video_id": videoID})
+	}
+
+	return nil
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+	repo "github.com/ozencb/couchtube/repositories"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenPrefix   = "ctk_"
+	sessionPrefix = "cts_"
+
+	// tokenTouchInterval limits how often the last use of a token is
+	// written, so API clients don't cause a write on every request.
+	tokenTouchInterval = time.Minute
+
+	// dummyPasswordHash is the bcrypt hash of a random password nobody
+	// knows.
+	dummyPasswordHash = "$2a$10$f9wLcws3aQ.xkh/dLwUOueOOXBaAr162dscckR27PPxkgBTFqOmEO"
+
+	// maxOIDCNameTries is how many numbered names are tried for a new
+	// OpenID Connect user whose name is taken.
+	maxOIDCNameTries = 100
+)
+
+type AuthService struct {
+	AuthRepo   repo.AuthRepository
+	UserRepo   repo.UserRepository
+	Password   string
+	SessionTTL time.Duration
+	// OIDC signs users in with an OpenID Connect provider. It is nil when
+	// that is disabled.
+	OIDC   *auth.OIDCProvider
+	Logger *slog.Logger
+
+	pins *throttle
+}
+
+func NewAuthService(authRepo repo.AuthRepository, userRepo repo.UserRepository, password string, sessionTTL time.Duration, oidcProvider *auth.OIDCProvider, logger *slog.Logger) *AuthService {
+	return &AuthService{
+		AuthRepo:   authRepo,
+		UserRepo:   userRepo,
+		Password:   password,
+		SessionTTL: sessionTTL,
+		OIDC:       oidcProvider,
+		Logger:     logger,
+		pins:       newThrottle(maxPinFailures, pinLockout, maxPinLockout),
+	}
+}
+
+// PasswordEnabled reports whether admins can sign in to the web UI with
+// the admin password.
+func (s *AuthService) PasswordEnabled() bool {
+	return s.Password != ""
+}
+
+// UserPasswordsEnabled reports whether any user can sign in to the web UI
+// with their own password.
+func (s *AuthService) UserPasswordsEnabled(ctx context.Context) (bool, error) {
+	return s.UserRepo.HasPasswordUsers(ctx)
+}
+
+// OIDCEnabled reports whether users can sign in to the web UI with an
+// OpenID Connect provider.
+func (s *AuthService) OIDCEnabled() bool {
+	return s.OIDC != nil
+}
+
+// CreateToken stores a new API token named name and returns it. The token
+// can't be looked up again later.
+func (s *AuthService) CreateToken(ctx context.Context, name string) (string, error) {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return "", err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", apperrors.Validation("A token needs a name")
+	}
+
+	token := auth.NewSecret(tokenPrefix)
+	_, err := s.AuthRepo.SaveToken(ctx, dbmodels.APIToken{
+		Name:      name,
+		TokenHash: auth.Hash(token),
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *AuthService) ListTokens(ctx context.Context) ([]dbmodels.APIToken, error) {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	return s.AuthRepo.FetchTokens(ctx)
+}
+
+// RevokeToken deletes the token with the given name or ID.
+func (s *AuthService) RevokeToken(ctx context.Context, ref string) error {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return err
+	}
+
+	return s.AuthRepo.DeleteToken(ctx, ref)
+}
+
+// AuthenticateToken returns the identity of an API token. Tokens are
+// admins.
+func (s *AuthService) AuthenticateToken(ctx context.Context, token string) (*auth.Identity, error) {
+	stored, err := s.AuthRepo.FindTokenByHash(ctx, auth.Hash(token))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, apperrors.Unauthenticated("Invalid API token")
+	}
+
+	now := time.Now()
+	if stored.LastUsedAt == nil || now.Sub(time.Unix(*stored.LastUsedAt, 0)) >= tokenTouchInterval {
+		if err := s.AuthRepo.TouchToken(ctx, stored.ID, now.Unix()); err != nil {
+			s.Logger.WarnContext(ctx, "Failed to record token use", "token", stored.Name, "error", err)
+		}
+	}
+
+	return &auth.Identity{Name: stored.Name, Role: auth.RoleAdmin, Method: auth.MethodToken}, nil
+}
+
+// Login checks the password of the user name, or the admin password when
+// name is empty, and starts a web UI session, returning its ID and when it
+// expires.
+func (s *AuthService) Login(ctx context.Context, name string, password string) (string, time.Time, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return s.loginAdmin(ctx, password)
+	}
+
+	user, err := s.UserRepo.FindUserByName(ctx, name)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Unknown users and users without a password are checked against a
+	// dummy hash, so they take as long to turn down as wrong passwords
+	hash := dummyPasswordHash
+	if user != nil && user.PasswordHash != "" {
+		hash = user.PasswordHash
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || hash == dummyPasswordHash {
+		return "", time.Time{}, apperrors.Unauthenticated("Wrong user name or password")
+	}
+
+	return s.startSession(ctx, &user.ID, user.Name)
+}
+
+func (s *AuthService) loginAdmin(ctx context.Context, password string) (string, time.Time, error) {
+	if !s.PasswordEnabled() {
+		return "", time.Time{}, apperrors.Unsupported("Sign-in with the admin password is disabled", nil)
+	}
+
+	// Hashing first makes the comparison take the same time for passwords
+	// of any length
+	given, expected := auth.Hash(password), auth.Hash(s.Password)
+	if subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+		return "", time.Time{}, apperrors.Unauthenticated("Wrong password")
+	}
+
+	return s.startSession(ctx, nil, "admin")
+}
+
+// StartOIDCLogin returns the URL of the OpenID Connect provider to send the
+// browser to, and the flow to keep until it comes back.
+func (s *AuthService) StartOIDCLogin(ctx context.Context) (string, auth.OIDCFlow, error) {
+	if !s.OIDCEnabled() {
+		return "", auth.OIDCFlow{}, apperrors.Unsupported("Sign-in with OpenID Connect is disabled", nil)
+	}
+
+	flow := auth.NewOIDCFlow()
+	url, err := s.OIDC.AuthCodeURL(ctx, flow)
+	return url, flow, err
+}
+
+// FinishOIDCLogin checks the state and code the provider sent the browser
+// back with, and starts a web UI session for the user. The user is created
+// on first sign-in, and gets the role their claims map to every time. Users
+// are told apart by the issuer and subject of their ID token, so one whose
+// name is already taken gets a numbered name instead of someone else's
+// account.
+func (s *AuthService) FinishOIDCLogin(ctx context.Context, state string, code string, flow auth.OIDCFlow) (string, time.Time, error) {
+	if !s.OIDCEnabled() {
+		return "", time.Time{}, apperrors.Unsupported("Sign-in with OpenID Connect is disabled", nil)
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(flow.State)) != 1 {
+		return "", time.Time{}, apperrors.Validation("The sign-in expired or was started elsewhere, please try again")
+	}
+
+	identity, err := s.OIDC.Exchange(ctx, code, flow)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var userID int
+	for n := 1; ; n++ {
+		name := identity.Name
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d", identity.Name, n)
+		}
+		userID, err = s.UserRepo.UpsertOIDCUser(ctx, dbmodels.User{
+			Name:      name,
+			Role:      string(identity.Role),
+			CreatedAt: time.Now().Unix(),
+		}, identity.Issuer, identity.Subject)
+		if !apperrors.Is(err, apperrors.CodeConflict) || n == maxOIDCNameTries {
+			break
+		}
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	user, err := s.UserRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if user == nil {
+		return "", time.Time{}, apperrors.Internal("Failed to sign in", fmt.Errorf("user %d disappeared", userID))
+	}
+	s.Logger.InfoContext(ctx, "User signed in with OpenID Connect", "user", user.Name, "role", user.Role)
+
+	return s.startSession(ctx, &user.ID, user.Name)
+}
+
+// startSession starts a web UI session for the user userID, or for an admin
+// password sign-in when it is nil, returning its ID and when it expires.
+func (s *AuthService) startSession(ctx context.Context, userID *int, name string) (string, time.Time, error) {
+	now := time.Now()
+	if err := s.AuthRepo.DeleteExpiredSessions(ctx, now.Unix()); err != nil {
+		return "", time.Time{}, err
+	}
+
+	sessionID := auth.NewSecret(sessionPrefix)
+	expiresAt := now.Add(s.SessionTTL)
+	err := s.AuthRepo.SaveSession(ctx, dbmodels.Session{
+		IDHash:    auth.Hash(sessionID),
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return sessionID, expiresAt, nil
+}
+
+// AuthenticateSession returns the identity of a web UI session, with the
+// current role and max rating of its user, or nil if the session expired or was ended.
+// Admin password sign-ins also end when the admin password is unset.
+func (s *AuthService) AuthenticateSession(ctx context.Context, sessionID string) (*auth.Identity, error) {
+	session, err := s.AuthRepo.FindSession(ctx, auth.Hash(sessionID), time.Now().Unix())
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	if session.UserID == nil {
+		if !s.PasswordEnabled() {
+			return nil, nil
+		}
+		return &auth.Identity{Name: session.Name, Role: auth.RoleAdmin, Method: auth.MethodSession}, nil
+	}
+
+	user, err := s.UserRepo.FindUserByID(ctx, *session.UserID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	return &auth.Identity{UserID: user.ID, Name: user.Name, Role: auth.Role(user.Role), MaxRating: user.MaxRating, Method: auth.MethodSession}, nil
+}
+
+// Logout ends a web UI session.
+func (s *AuthService) Logout(ctx context.Context, sessionID string) error {
+	return s.AuthRepo.DeleteSession(ctx, auth.Hash(sessionID))
+}
+
+// ListUsers returns every user.
+func (s *AuthService) ListUsers(ctx context.Context) ([]dbmodels.User, error) {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	return s.UserRepo.FetchUsers(ctx)
+}
+
+// FindUser returns the user with the given name.
+func (s *AuthService) FindUser(ctx context.Context, name string) (*dbmodels.User, error) {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserRepo.FindUserByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, apperrors.NotFound("User not found").WithDetails(map[string]interface{}{"user": name})
+	}
+
+	return user, nil
+}
+
+// SaveUser creates the user request.Name, or updates an existing one, and
+// reports whether it was created. An empty role or password leaves the one
+// the user has, and new users are viewers unless the role says otherwise.
+// The max rating and PIN are only changed when given. Everything is checked
+// before the user is written, in a single statement, so a bad value leaves
+// the user as it was.
+func (s *AuthService) SaveUser(ctx context.Context, request jsonmodels.UserRequestJson) (bool, error) {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return false, err
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		return false, apperrors.Validation("A user needs a name")
+	}
+	if request.Role != "" {
+		if _, err := auth.ParseRole(request.Role); err != nil {
+			return false, err
+		}
+	}
+
+	var passwordHash string
+	if request.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return false, apperrors.Validation("Passwords can be at most 72 bytes long")
+		}
+		if err != nil {
+			return false, err
+		}
+		passwordHash = string(hash)
+	}
+
+	var maxRating, pinHash string
+	if request.MaxRating != nil {
+		rating, err := parseMaxRating(*request.MaxRating)
+		if err != nil {
+			return false, err
+		}
+		maxRating = rating
+	}
+	if request.Pin != nil {
+		hash, err := hashPIN(*request.Pin)
+		if err != nil {
+			return false, err
+		}
+		pinHash = hash
+	}
+
+	user, err := s.UserRepo.FindUserByName(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	if user == nil {
+		user = &dbmodels.User{Name: name, Role: string(auth.RoleViewer), CreatedAt: time.Now().Unix()}
+	}
+	if request.Role != "" {
+		user.Role = request.Role
+	}
+	if passwordHash != "" {
+		user.PasswordHash = passwordHash
+	}
+	if request.MaxRating != nil {
+		user.MaxRating = maxRating
+	}
+	if request.Pin != nil {
+		user.PinHash = pinHash
+	}
+
+	if user.ID == 0 {
+		_, err := s.UserRepo.SaveUser(ctx, *user)
+		return err == nil, err
+	}
+	return false, s.UserRepo.UpdateUser(ctx, *user)
+}
+
+// DeleteUser removes the user name, signing them out everywhere.
+func (s *AuthService) DeleteUser(ctx context.Context, name string) error {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return err
+	}
+
+	return s.UserRepo.DeleteUser(ctx, name)
+}
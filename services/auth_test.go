@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+)
+
+func TestFinishOIDCLoginStateMismatch(t *testing.T) {
+	// Sign-ins with the wrong state must be turned down before the code is
+	// redeemed, so the provider is never contacted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("provider contacted at %s", r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	provider, err := auth.NewOIDCProvider(auth.OIDCConfig{
+		DiscoveryURL: server.URL,
+		ClientID:     "couchtube",
+		RedirectURL:  "https://tv.example.org/api/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewAuthService(nil, nil, "", time.Hour, provider, testLogger)
+
+	flow := auth.NewOIDCFlow()
+	tests := []struct {
+		name  string
+		state string
+	}{
+		{name: "missing state", state: ""},
+		{name: "state of another sign-in", state: auth.NewOIDCFlow().State},
+		{name: "truncated state", state: flow.State[:len(flow.State)-1]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sessionID, _, err := service.FinishOIDCLogin(context.Background(), test.state, "code", flow)
+			if !apperrors.Is(err, apperrors.CodeValidation) || sessionID != "" {
+				t.Errorf("got session %q, error %v, want a validation error", sessionID, err)
+			}
+		})
+	}
+}
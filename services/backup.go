@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/db"
+	"github.com/ozencb/couchtube/metrics"
+	repo "github.com/ozencb/couchtube/repositories"
+)
+
+const backupFilePattern = "couchtube-*.db"
+
+type BackupService struct {
+	TxManager   repo.TxManager
+	ChannelRepo repo.ChannelRepository
+	Dir         string
+	Retention   int
+	Logger      *slog.Logger
+
+	mu         sync.Mutex
+	lastError  error
+	lastFailed time.Time
+}
+
+func NewBackupService(txManager repo.TxManager, channelRepo repo.ChannelRepository, dir string, retention int, logger *slog.Logger) *BackupService {
+	return &BackupService{
+		TxManager:   txManager,
+		ChannelRepo: channelRepo,
+		Dir:         dir,
+		Retention:   retention,
+		Logger:      logger,
+	}
+}
+
+// Snapshot writes a copy of the database to path. Snapshots hold the
+// password hashes of users, so only admins may take them.
+func (s *BackupService) Snapshot(ctx context.Context, path string) error {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return err
+	}
+
+	return backupError(db.Snapshot(ctx, s.TxManager.GetDB(), path))
+}
+
+// SnapshotToTemp writes a copy of the database to a new temporary file and
+// returns its path. The caller removes the file.
+func (s *BackupService) SnapshotToTemp(ctx context.Context) (string, error) {
+	dir, err := os.MkdirTemp("", "couchtube-backup-")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, BackupFileName(time.Now()))
+	if err := s.Snapshot(ctx, path); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// Create writes a new backup to the backup directory and prunes the oldest
+// ones beyond the retention count.
+func (s *BackupService) Create(ctx context.Context) (string, error) {
+	if s.Dir == "" {
+		return "", fmt.Errorf("no backup directory configured")
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.Dir, BackupFileName(time.Now()))
+	if err := s.Snapshot(ctx, path); err != nil {
+		return "", err
+	}
+
+	return path, s.prune()
+}
+
+func (s *BackupService) prune() error {
+	if s.Retention < 1 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(filepath.Join(s.Dir, backupFilePattern))
+	if err != nil {
+		return err
+	}
+
+	// Backup names sort by the time they were taken
+	sort.Strings(backups)
+	for len(backups) > s.Retention {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		s.Logger.Info("Removed old backup", "path", backups[0])
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// Schedule takes a backup every interval until ctx is canceled. A backup
+// that is being written when that happens is finished first.
+func (s *BackupService) Schedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	metrics.WorkerUp.WithLabelValues("backups").Set(1)
+	defer metrics.WorkerUp.WithLabelValues("backups").Set(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Not tied to ctx, so a shutdown doesn't leave a partly
+			// written snapshot behind
+			path, err := s.Create(context.WithoutCancel(ctx))
+			s.recordResult(err)
+			metrics.ObserveWorkerRun("backups", err)
+			if err != nil {
+				s.Logger.Error("Scheduled backup failed", "error", err)
+				continue
+			}
+			s.Logger.Info("Backup written", "path", path)
+		}
+	}
+}
+
+func (s *BackupService) recordResult(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastError = err
+	if err != nil {
+		s.lastFailed = time.Now()
+	}
+}
+
+// CheckSchedule returns an error if the last scheduled backup failed.
+func (s *BackupService) CheckSchedule() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastError != nil {
+		return fmt.Errorf("scheduled backup at %s failed: %w", s.lastFailed.Format(time.RFC3339), s.lastError)
+	}
+	return nil
+}
+
+// Restore replaces all data in the database with the backup at path.
+func (s *BackupService) Restore(ctx context.Context, path string) error {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return err
+	}
+
+	if err := db.RestoreSnapshot(ctx, s.TxManager.GetDB(), path); err != nil {
+		return backupError(err)
+	}
+
+	// Backups taken before channels had slugs need them filled in
+	return db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		return assignMissingSlugs(ctx, tx, s.ChannelRepo)
+	})
+}
+
+// backupError types the errors of the db package that are caused by the
+// request rather than the server.
+func backupError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrBackupUnsupported):
+		return apperrors.Unsupported("Backups are only supported for SQLite databases", err)
+	case errors.Is(err, db.ErrInvalidBackup):
+		return apperrors.Validation(err.Error())
+	default:
+		return err
+	}
+}
+
+func BackupFileName(at time.Time) string {
+	return "couchtube-" + at.UTC().Format("20060102-150405") + ".db"
+}
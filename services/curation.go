@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/db"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+// EditableChannels returns the channels of the caller's lineup they may
+// edit: the ones they own, every channel of their personal lineup, or every
+// channel for admins.
+func (s *MediaService) EditableChannels(ctx context.Context) ([]dbmodels.Channel, error) {
+	identity, err := auth.Require(ctx, auth.RoleCurator)
+	if err != nil {
+		return nil, err
+	}
+	profileID, err := s.activeProfile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := s.ChannelRepo.FetchChannels(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	editable := []dbmodels.Channel{}
+	for _, channel := range inLineup(channels, profileID) {
+		if canEdit(identity, channel) {
+			editable = append(editable, channel)
+		}
+	}
+
+	return editable, nil
+}
+
+// CreateChannel creates a channel owned by the caller in their lineup, with
+// the videos in channel if it has any. Imports leave it alone.
+func (s *MediaService) CreateChannel(ctx context.Context, channel jsonmodels.ChannelJson) (*dbmodels.Channel, error) {
+	identity, err := auth.Require(ctx, auth.RoleCurator)
+	if err != nil {
+		return nil, err
+	}
+	profileID, err := s.activeProfile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := channel.Normalize(); err != nil {
+		return nil, apperrors.Validation(err.Error())
+	}
+	entries := make([]dbmodels.ChannelVideo, 0, len(channel.Videos))
+	for _, video := range channel.Videos {
+		entry, err := curatedEntry(video)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	row := dbmodels.Channel{
+		Slug:   channel.Slug,
+		Number: channel.Number.String(),
+		Name:   channel.Name,
+		Rating: string(channel.Rating),
+		Source: dbmodels.ChannelSourceCurated,
+	}
+	// API tokens and admin password sign-ins aren't users, so their
+	// channels have no owner and only admins may edit them
+	if identity.UserID != 0 {
+		row.OwnerID = &identity.UserID
+	}
+	if profileID != 0 {
+		row.ProfileID = &profileID
+	}
+
+	err = db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		var err error
+		row.ID, err = s.ChannelRepo.CreateChannel(ctx, tx, row)
+		if err != nil {
+			return err
+		}
+		return s.saveEntries(ctx, tx, row.ID, entries)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.Logger.InfoContext(ctx, "Channel created", "channel", row.Slug, "user", identity.Name)
+	return &row, nil
+}
+
+// DeleteChannel removes a channel the caller may edit, along with the videos
+// no other channel plays.
+func (s *MediaService) DeleteChannel(ctx context.Context, ref string) error {
+	channel, err := s.editableChannel(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	return db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		if err := s.ChannelRepo.DeleteChannel(ctx, tx, channel.ID); err != nil {
+			return err
+		}
+		_, err := s.VideoRepo.DeleteOrphanVideos(ctx, tx)
+		return err
+	})
+}
+
+// ChannelEntries returns the lineup of a channel the caller may edit,
+// including quarantined videos.
+func (s *MediaService) ChannelEntries(ctx context.Context, ref string) ([]dbmodels.ChannelVideo, error) {
+	channel, err := s.editableChannel(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.VideoRepo.GetChannelEntries(ctx, nil, channel.ID)
+}
+
+// AddVideo appends a video to the end of the lineup of a channel the caller
+// may edit.
+func (s *MediaService) AddVideo(ctx context.Context, ref string, video jsonmodels.VideoJson) error {
+	channel, err := s.editableChannel(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	entry, err := curatedEntry(video)
+	if err != nil {
+		return err
+	}
+
+	return db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		return s.VideoRepo.SaveVideo(ctx, tx, channel.ID, entry.Video, entry.SectionStart, entry.SectionEnd, entry.Rating)
+	})
+}
+
+// RemoveEntry removes an entry from the lineup of a channel the caller may
+// edit.
+func (s *MediaService) RemoveEntry(ctx context.Context, ref string, entryID int) error {
+	channel, err := s.editableChannel(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	return db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		if err := s.VideoRepo.DeleteEntry(ctx, tx, channel.ID, entryID); err != nil {
+			return err
+		}
+		_, err := s.VideoRepo.DeleteOrphanVideos(ctx, tx)
+		return err
+	})
+}
+
+// SetChannelOwner gives a channel of the caller's lineup to the user with ID
+// ownerID, or takes it from its owner when ownerID is nil. Only admins may do
+// that.
+func (s *MediaService) SetChannelOwner(ctx context.Context, ref string, ownerID *int) error {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return err
+	}
+
+	channel, err := s.FindChannel(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	return s.ChannelRepo.SetChannelOwner(ctx, channel.ID, ownerID)
+}
+
+// editableChannel resolves ref to a channel of the caller's lineup and checks
+// that the caller may edit it.
+func (s *MediaService) editableChannel(ctx context.Context, ref string) (*dbmodels.Channel, error) {
+	identity, err := auth.Require(ctx, auth.RoleCurator)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := s.FindChannel(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !canEdit(identity, *channel) {
+		return nil, apperrors.Forbidden("Only the owner of a channel may edit it").WithDetails(map[string]interface{}{"channel": ref})
+	}
+
+	return channel, nil
+}
+
+func canEdit(identity *auth.Identity, channel dbmodels.Channel) bool {
+	if identity.Role.Includes(auth.RoleAdmin) {
+		return true
+	}
+	if identity.UserID == 0 {
+		return false
+	}
+	return lineupOf(channel) == identity.UserID || (channel.OwnerID != nil && *channel.OwnerID == identity.UserID)
+}
+
+// youTubeIDPattern matches YouTube video IDs.
+var youTubeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// curatedEntry checks a video added by a curator. Library videos belong to
+// the media library, and videos hosted elsewhere get the ID of their URL, so
+// a curator can't point a video of another channel somewhere else.
+func curatedEntry(video jsonmodels.VideoJson) (dbmodels.ChannelVideo, error) {
+	if video.Source == dbmodels.VideoSourceLocal {
+		return dbmodels.ChannelVideo{}, apperrors.Validation("Local videos can only come from the media library")
+	}
+	if video.Source == dbmodels.VideoSourceDirect || video.Source == dbmodels.VideoSourceHLS {
+		video.Id = ""
+	}
+	if err := video.Normalize(); err != nil {
+		return dbmodels.ChannelVideo{}, apperrors.Validation(err.Error())
+	}
+	if video.Source == dbmodels.VideoSourceYouTube && !youTubeIDPattern.MatchString(video.Id) {
+		return dbmodels.ChannelVideo{}, apperrors.Validation("Invalid YouTube video ID").WithDetails(map[string]interface{}{"id": video.Id})
+	}
+
+	return dbmodels.ChannelVideo{
+		SectionStart: video.SectionStart,
+		SectionEnd:   video.SectionEnd,
+		Rating:       string(video.Rating),
+		Video:        dbmodels.Video{ID: video.Id, Source: video.Source, URL: video.Url},
+	}, nil
+}
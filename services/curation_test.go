@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/config"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+func TestAddVideoLeavesSharedVideosAlone(t *testing.T) {
+	service := newTestMediaService(newTestDB(t), &config.Config{})
+	ctx := auth.WithIdentity(context.Background(), auth.CommandLine)
+
+	trailer := jsonmodels.VideoJson{Id: "dQw4w9WgXcQ", Source: dbmodels.VideoSourceDirect, Url: "https://media.example.org/trailer.mp4", SectionStart: 0, SectionEnd: 60}
+	news := listChannel("News", "news", "1", "aaaaaaaaaaa")
+	news.Videos = append(news.Videos, trailer)
+	if _, err := service.ImportChannels(ctx, "", jsonmodels.ChannelsJson{Channels: []jsonmodels.ChannelJson{news}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.CreateChannel(ctx, jsonmodels.ChannelJson{Name: "Picks", Slug: "picks"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		video   jsonmodels.VideoJson
+		wantErr apperrors.Code
+	}{
+		{name: "video another channel plays", video: jsonmodels.VideoJson{Id: "aaaaaaaaaaa", SectionStart: 10, SectionEnd: 20}},
+		{name: "direct video another channel plays", video: trailer},
+		{name: "YouTube video with the ID of a direct one", video: jsonmodels.VideoJson{Id: "dQw4w9WgXcQ", SectionStart: 0, SectionEnd: 60}, wantErr: apperrors.CodeConflict},
+	}
+
+	for _, test := range tests {
+		err := service.AddVideo(ctx, "picks", test.video)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if test.wantErr != "" && !apperrors.Is(err, test.wantErr) {
+			t.Errorf("%s gave %v, want %s", test.name, err, test.wantErr)
+		}
+	}
+
+	entries, err := service.ChannelEntries(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if got := entries[1].Video; got.Source != dbmodels.VideoSourceDirect || got.URL != trailer.Url {
+		t.Errorf("shared video became %s %q, want it left as %s %q", got.Source, got.URL, dbmodels.VideoSourceDirect, trailer.Url)
+	}
+
+	picks, err := service.ChannelEntries(ctx, "picks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(picks) != 2 {
+		t.Errorf("got %d entries in the curated channel, want the 2 that were added", len(picks))
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ozencb/couchtube/auth"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+// ExportChannels returns a lineup in the same format as the channel list
+// JSON, so it can be imported again. That is the lineup of the user named
+// profile, which only admins may export, or the caller's own lineup when
+// profile is empty. Only the channels referenced by slug, number or ID in
+// refs are exported when it isn't empty. Quarantined videos are included,
+// since they are still part of the lineup. Channels and videos rated above
+// the caller's limit are left out, and referring to such a channel is
+// refused like tuning to it.
+func (s *MediaService) ExportChannels(ctx context.Context, profile string, refs []string) (jsonmodels.ChannelsJson, error) {
+	export := jsonmodels.ChannelsJson{Channels: []jsonmodels.ChannelJson{}}
+
+	profileID, err := s.activeProfile(ctx)
+	if profile != "" {
+		if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+			return export, err
+		}
+		profileID, err = s.profileID(ctx, profile)
+	}
+	if err != nil {
+		return export, err
+	}
+
+	var channels []dbmodels.Channel
+	if len(refs) == 0 {
+		all, err := s.ChannelRepo.FetchChannels(ctx, nil)
+		if err != nil {
+			return export, err
+		}
+		for _, channel := range inLineup(all, profileID) {
+			if s.allowed(ctx, channel.Rating) {
+				channels = append(channels, channel)
+			}
+		}
+	} else {
+		for _, ref := range refs {
+			channel, err := s.ChannelRepo.FindChannel(ctx, profileID, ref)
+			if err != nil {
+				return export, err
+			}
+			if err := s.checkRating(ctx, ref, channel); err != nil {
+				return export, err
+			}
+			channels = append(channels, *channel)
+		}
+	}
+
+	for _, channel := range channels {
+		entries, err := s.VideoRepo.GetChannelEntries(ctx, nil, channel.ID)
+		if err != nil {
+			return export, err
+		}
+
+		exported := jsonmodels.ChannelJson{
+			Name:   channel.Name,
+			Slug:   channel.Slug,
+			Number: json.Number(channel.Number),
+			Rating: jsonmodels.Rating(channel.Rating),
+			Videos: make([]jsonmodels.VideoJson, 0, len(entries)),
+		}
+		for _, entry := range entries {
+			if !s.allowed(ctx, entryRating(&channel, &entry)) {
+				continue
+			}
+			video := jsonmodels.VideoJson{
+				Id:           entry.ID,
+				Source:       entry.Source,
+				Url:          entry.URL,
+				SectionStart: entry.SectionStart,
+				SectionEnd:   entry.SectionEnd,
+				Rating:       jsonmodels.Rating(entry.Rating),
+			}
+			// YouTube is the default source, so leave it out like hand
+			// written lists do
+			if video.Source == dbmodels.VideoSourceYouTube {
+				video.Source = ""
+			}
+			exported.Videos = append(exported.Videos, video)
+		}
+		export.Channels = append(export.Channels, exported)
+	}
+
+	return export, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ozencb/couchtube/config"
+	"github.com/ozencb/couchtube/db/dialect"
+	"github.com/ozencb/couchtube/db/migrations"
+	repo "github.com/ozencb/couchtube/repositories"
+	_ "modernc.org/sqlite"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestDB returns an empty, migrated SQLite database.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	database, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "couchtube.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	migrator, err := migrations.NewMigrator(database, dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	return database
+}
+
+func newTestMediaService(database *sql.DB, cfg *config.Config) *MediaService {
+	return NewMediaService(
+		repo.NewTxManager(database),
+		repo.NewChannelRepository(database, dialect.SQLite, testLogger),
+		repo.NewVideoRepository(database, dialect.SQLite, testLogger),
+		repo.NewUserRepository(database, dialect.SQLite, testLogger),
+		repo.NewPreferenceRepository(database, dialect.SQLite, testLogger),
+		cfg,
+		testLogger,
+	)
+}
+
+func newTestAuthService(database *sql.DB) *AuthService {
+	return NewAuthService(
+		repo.NewAuthRepository(database, dialect.SQLite, testLogger),
+		repo.NewUserRepository(database, dialect.SQLite, testLogger),
+		"",
+		time.Hour,
+		nil,
+		testLogger,
+	)
+}
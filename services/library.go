@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/db"
+	"github.com/ozencb/couchtube/library"
+	"github.com/ozencb/couchtube/metrics"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	repo "github.com/ozencb/couchtube/repositories"
+)
+
+type LibraryService struct {
+	TxManager   repo.TxManager
+	ChannelRepo repo.ChannelRepository
+	VideoRepo   repo.VideoRepository
+	Root        string
+	Prober      library.Prober
+	Logger      *slog.Logger
+}
+
+func NewLibraryService(txManager repo.TxManager, channelRepo repo.ChannelRepository, videoRepo repo.VideoRepository, root string, prober library.Prober, logger *slog.Logger) *LibraryService {
+	return &LibraryService{
+		TxManager:   txManager,
+		ChannelRepo: channelRepo,
+		VideoRepo:   videoRepo,
+		Root:        root,
+		Prober:      prober,
+		Logger:      logger,
+	}
+}
+
+// Sync scans the media library and replaces the library channels in the
+// database with what was found on disk. Channels whose folder has gone away
+// are removed. Folders named like a channel from another source are skipped.
+func (s *LibraryService) Sync(ctx context.Context) (err error) {
+	defer func(start time.Time) {
+		metrics.ObserveImport("library", start, err)
+	}(time.Now())
+
+	scanned, err := library.Scan(s.Root, s.Prober)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(scanned.Channels))
+	err = db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+
+		for _, channel := range scanned.Channels {
+			// Library channels keep the slug they were given when first seen
+			channelID, err := s.ChannelRepo.SaveChannel(ctx, tx, dbmodels.Channel{Name: channel.Name, Source: dbmodels.ChannelSourceLibrary})
+			if apperrors.Is(err, apperrors.CodeConflict) {
+				s.Logger.Warn("Skipping library folder named like another channel", "channel", channel.Name)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := s.VideoRepo.DeleteChannelVideos(ctx, tx, channelID); err != nil {
+				return err
+			}
+
+			for _, video := range channel.Videos {
+				v := dbmodels.Video{ID: video.Id, Source: video.Source, URL: video.Url}
+				if err := s.VideoRepo.SaveVideo(ctx, tx, channelID, v, video.SectionStart, video.SectionEnd, ""); err != nil {
+					return err
+				}
+			}
+			names = append(names, channel.Name)
+		}
+
+		if err := s.ChannelRepo.DeleteChannelsBySource(ctx, tx, dbmodels.ChannelSourceLibrary, names); err != nil {
+			return err
+		}
+
+		if _, err := s.VideoRepo.DeleteOrphanVideos(ctx, tx); err != nil {
+			return err
+		}
+
+		return assignMissingSlugs(ctx, tx, s.ChannelRepo)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info("Media library synced", "channels", len(names), "path", s.Root)
+	return nil
+}
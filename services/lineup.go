@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+)
+
+// activeProfile returns the user whose lineup the caller watches: their own
+// if they have a personal lineup, or 0 for the shared lineup.
+func (s *MediaService) activeProfile(ctx context.Context) (int, error) {
+	identity := auth.FromContext(ctx)
+	if identity == nil || identity.UserID == 0 {
+		return 0, nil
+	}
+
+	personal, err := s.ChannelRepo.HasLineup(ctx, identity.UserID)
+	if err != nil || !personal {
+		return 0, err
+	}
+	return identity.UserID, nil
+}
+
+// profileID resolves the name of a user to the ID of their lineup. An empty
+// name stands for the shared lineup.
+func (s *MediaService) profileID(ctx context.Context, profile string) (int, error) {
+	if profile == "" {
+		return 0, nil
+	}
+
+	user, err := s.UserRepo.FindUserByName(ctx, profile)
+	if err != nil {
+		return 0, err
+	}
+	if user == nil {
+		return 0, apperrors.NotFound("User not found").WithDetails(map[string]interface{}{"profile": profile})
+	}
+	return user.ID, nil
+}
+
+// inLineup returns the channels of channels in the lineup of profileID, or
+// in the shared lineup when it is 0.
+func inLineup(channels []dbmodels.Channel, profileID int) []dbmodels.Channel {
+	var lineup []dbmodels.Channel
+	for _, channel := range channels {
+		if lineupOf(channel) == profileID {
+			lineup = append(lineup, channel)
+		}
+	}
+	return lineup
+}
+
+// lineupOf returns the user whose lineup channel is in, or 0 for the shared
+// lineup.
+func lineupOf(channel dbmodels.Channel) int {
+	if channel.ProfileID == nil {
+		return 0
+	}
+	return *channel.ProfileID
+}
+
+// lineupKey prefixes slugs so they only clash within a lineup.
+func lineupKey(channel dbmodels.Channel) string {
+	return fmt.Sprintf("%d:", lineupOf(channel))
+}
@@ -1,43 +1,102 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/config"
 	"github.com/ozencb/couchtube/db"
+	"github.com/ozencb/couchtube/metrics"
 	dbmodels "github.com/ozencb/couchtube/models/db"
 	jsonmodels "github.com/ozencb/couchtube/models/json"
 	repo "github.com/ozencb/couchtube/repositories"
 )
 
 type MediaService struct {
-	TxManager   repo.TxManager
-	ChannelRepo repo.ChannelRepository
-	VideoRepo   repo.VideoRepository
+	TxManager      repo.TxManager
+	ChannelRepo    repo.ChannelRepository
+	VideoRepo      repo.VideoRepository
+	UserRepo       repo.UserRepository
+	PreferenceRepo repo.PreferenceRepository
+	Config         *config.Config
+	Logger         *slog.Logger
 }
 
-func NewMediaService(txManager repo.TxManager, channelRepo repo.ChannelRepository, videoRepo repo.VideoRepository) *MediaService {
+func NewMediaService(txManager repo.TxManager, channelRepo repo.ChannelRepository, videoRepo repo.VideoRepository, userRepo repo.UserRepository, preferenceRepo repo.PreferenceRepository, cfg *config.Config, logger *slog.Logger) *MediaService {
 	return &MediaService{
-		TxManager:   txManager,
-		ChannelRepo: channelRepo,
-		VideoRepo:   videoRepo,
+		TxManager:      txManager,
+		ChannelRepo:    channelRepo,
+		VideoRepo:      videoRepo,
+		UserRepo:       userRepo,
+		PreferenceRepo: preferenceRepo,
+		Config:         cfg,
+		Logger:         logger,
 	}
 }
 
-func (s *MediaService) FetchAllChannels() ([]dbmodels.Channel, error) {
-	channels, err := s.ChannelRepo.FetchAllChannels()
+// FetchAllChannels returns the channels of the caller's lineup that have
+// something to play, in the order they arranged them. Channels they hid and
+// the ones rated above their limit are left out.
+func (s *MediaService) FetchAllChannels(ctx context.Context) ([]dbmodels.Channel, error) {
+	channels, err := s.arrangedChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	visible := []dbmodels.Channel{}
+	for _, channel := range channels {
+		if !channel.Hidden {
+			visible = append(visible, channel)
+		}
+	}
+
+	return visible, nil
+}
+
+// ListChannels returns every channel of every lineup, including the ones
+// with nothing to play.
+func (s *MediaService) ListChannels(ctx context.Context) ([]dbmodels.Channel, error) {
+	return s.ChannelRepo.FetchChannels(ctx, nil)
+}
+
+// FindChannel resolves a channel of the caller's lineup from its slug,
+// channel number or ID. Channels rated above the caller's limit can't be
+// tuned to.
+func (s *MediaService) FindChannel(ctx context.Context, ref string) (*dbmodels.Channel, error) {
+	profileID, err := s.activeProfile(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return channels, nil
+	channel, err := s.ChannelRepo.FindChannel(ctx, profileID, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkRating(ctx, ref, channel); err != nil {
+		return nil, err
+	}
+
+	return channel, nil
 }
 
-func (s *MediaService) GetCurrentVideoByChannelId(channelId int) (*dbmodels.Video, error) {
-	videos, err := s.VideoRepo.GetVideosByChannelID(channelId)
+func (s *MediaService) GetCurrentVideo(ctx context.Context, channel *dbmodels.Channel) (*dbmodels.ChannelVideo, error) {
+	return s.GetVideoAt(ctx, channel, time.Now())
+}
+
+// GetVideoAt returns the video that is on air on a channel at the given
+// time, with its section start moved to the second being played. Videos
+// rated above the caller's limit are replaced with filler.
+func (s *MediaService) GetVideoAt(ctx context.Context, channel *dbmodels.Channel, at time.Time) (*dbmodels.ChannelVideo, error) {
+	videos, err := s.VideoRepo.GetVideosByChannelID(ctx, channel.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +110,7 @@ func (s *MediaService) GetCurrentVideoByChannelId(channelId int) (*dbmodels.Vide
 		totalLength += int64(video.SectionEnd - video.SectionStart)
 	}
 
-	currentPoint := time.Now().UTC().Unix() % totalLength
+	currentPoint := at.UTC().Unix() % totalLength
 	videoIndex := -1
 
 	for i := range videos {
@@ -66,75 +125,216 @@ func (s *MediaService) GetCurrentVideoByChannelId(channelId int) (*dbmodels.Vide
 	}
 
 	if videoIndex == -1 {
-		return &videos[0], nil
+		return s.fillIn(ctx, channel, &videos[0]), nil
 	}
 
-	return &videos[videoIndex], nil
+	return s.fillIn(ctx, channel, &videos[videoIndex]), nil
 }
 
-func (s *MediaService) FetchNextVideo(channelId int, videoId int) *dbmodels.Video {
-	video, err := s.VideoRepo.FetchNextVideo(channelId, videoId)
+func (s *MediaService) FetchNextVideo(ctx context.Context, channel *dbmodels.Channel, entryId int) *dbmodels.ChannelVideo {
+	video, err := s.VideoRepo.FetchNextVideo(ctx, channel.ID, entryId)
 	if err != nil {
 		return nil
 	}
 
-	return video
+	return s.fillIn(ctx, channel, video)
+}
+
+// FetchNextVideoAfter returns the entry that follows the first entry of the
+// video videoID in the channel, for clients that still send the video ID
+// rather than the entry ID. Unknown videos start the channel over.
+func (s *MediaService) FetchNextVideoAfter(ctx context.Context, channel *dbmodels.Channel, videoID string) *dbmodels.ChannelVideo {
+	entries, err := s.VideoRepo.GetVideosByChannelID(ctx, channel.ID)
+	if err != nil {
+		return nil
+	}
+
+	entryID := 0
+	for _, entry := range entries {
+		if entry.ID == videoID {
+			entryID = entry.EntryID
+			break
+		}
+	}
+	return s.FetchNextVideo(ctx, channel, entryID)
+}
+
+// InvalidateVideo records a playback failure reported by a client. The video
+// is only taken off air, by quarantining it rather than deleting it, once
+// enough distinct reporters have failed to play it within the invalidation
+// window. It returns whether the video is quarantined.
+func (s *MediaService) InvalidateVideo(ctx context.Context, videoId string, reporter string, errorCode *int) (bool, error) {
+	quarantined := false
+
+	err := db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		status, err := s.VideoRepo.GetVideoStatus(ctx, tx, videoId)
+		if err != nil {
+			return err
+		}
+		if status == dbmodels.VideoStatusQuarantined {
+			quarantined = true
+			metrics.Invalidations.WithLabelValues("already_quarantined").Inc()
+			return nil
+		}
+
+		now := time.Now().UTC()
+		if err := s.VideoRepo.SaveReport(ctx, tx, videoId, reporter, errorCode, now.Unix()); err != nil {
+			return err
+		}
+
+		since := now.Add(-s.Config.InvalidationWindow).Unix()
+		reporters, err := s.VideoRepo.CountReporters(ctx, tx, videoId, since)
+		if err != nil {
+			return err
+		}
+		if reporters < s.Config.InvalidationThreshold {
+			metrics.Invalidations.WithLabelValues("reported").Inc()
+			return nil
+		}
+
+		quarantined = true
+		metrics.Invalidations.WithLabelValues("quarantined").Inc()
+		return s.VideoRepo.QuarantineVideo(ctx, tx, videoId)
+	})
+
+	return quarantined, err
 }
 
-func (s *MediaService) InvalidateVideo(videoId string) error {
-	return db.WithTransaction(s.TxManager.GetDB(), func(tx *sql.Tx) error {
-		return s.VideoRepo.DeleteVideo(tx, videoId)
+// QuarantineVideo takes a video off air right away, without waiting for
+// reports from clients.
+func (s *MediaService) QuarantineVideo(ctx context.Context, videoId string) error {
+	if _, err := auth.Require(ctx, auth.RoleCurator); err != nil {
+		return err
+	}
+
+	return db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		return s.VideoRepo.QuarantineVideo(ctx, tx, videoId)
 	})
 }
 
-func (s *MediaService) SubmitList(list jsonmodels.SubmitListRequestJson) (bool, error) {
+func (s *MediaService) FetchQuarantinedVideos(ctx context.Context) ([]dbmodels.Video, error) {
+	if _, err := auth.Require(ctx, auth.RoleCurator); err != nil {
+		return nil, err
+	}
+
+	return s.VideoRepo.GetQuarantinedVideos(ctx)
+}
+
+func (s *MediaService) RestoreVideo(ctx context.Context, videoId string) error {
+	if _, err := auth.Require(ctx, auth.RoleCurator); err != nil {
+		return err
+	}
+
+	return db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		return s.checkQuarantined(ctx, tx, videoId, s.VideoRepo.RestoreVideo(ctx, tx, videoId))
+	})
+}
+
+func (s *MediaService) PurgeVideo(ctx context.Context, videoId string) error {
+	if _, err := auth.Require(ctx, auth.RoleCurator); err != nil {
+		return err
+	}
+
+	return db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		return s.checkQuarantined(ctx, tx, videoId, s.VideoRepo.PurgeVideo(ctx, tx, videoId))
+	})
+}
+
+// checkQuarantined tells a video that doesn't exist apart from one that is
+// on air when err says no quarantined video was found.
+func (s *MediaService) checkQuarantined(ctx context.Context, tx *sql.Tx, videoId string, err error) error {
+	if !apperrors.Is(err, apperrors.CodeNotFound) {
+		return err
+	}
+	if _, statusErr := s.VideoRepo.GetVideoStatus(ctx, tx, videoId); statusErr != nil {
+		return err
+	}
+
+	return apperrors.Conflict("Video is not quarantined").WithDetails(map[string]interface{}{"video_id": videoId})
+}
+
+// SubmitList imports the channel list at the URL in list, replacing the
+// list channels of the lineup of list.Profile, or of the shared lineup. Only
+// admins may do that.
+func (s *MediaService) SubmitList(ctx context.Context, list jsonmodels.SubmitListRequestJson) (bool, error) {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return false, err
+	}
+
 	videoListUrl := list.VideoListUrl
 
 	if videoListUrl == "" {
 		return false, nil
 	}
 
-	// Fetch the video list from the provided URL
-	response, err := http.Get(videoListUrl)
+	fetchCtx := ctx
+	if s.Config.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		fetchCtx, cancel = context.WithTimeout(ctx, s.Config.FetchTimeout)
+		defer cancel()
+	}
+
+	videoList, err := FetchChannelList(fetchCtx, videoListUrl)
 	if err != nil {
 		return false, err
 	}
-	defer response.Body.Close()
 
-	var videoList jsonmodels.ChannelsJson
-	if err := json.NewDecoder(response.Body).Decode(&videoList); err != nil {
+	if len(videoList.Channels) == 0 {
+		return false, apperrors.Validation("The list has no channels").WithDetails(map[string]interface{}{"url": videoListUrl})
+	}
+
+	summary, err := s.ImportChannels(ctx, list.Profile, videoList)
+	if err != nil {
 		return false, err
 	}
 
-	if len(videoList.Channels) == 0 {
-		return false, nil
+	s.Logger.Info("Channel list submitted", "url", videoListUrl, "profile", list.Profile, "summary", summary.String())
+	return true, nil
+}
+
+// FetchChannelList downloads a channel list JSON from url.
+func FetchChannelList(ctx context.Context, url string) (jsonmodels.ChannelsJson, error) {
+	var channels jsonmodels.ChannelsJson
+
+	details := map[string]interface{}{"url": url}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return channels, apperrors.Validation("Invalid list URL").WithDetails(details)
 	}
 
-	err = db.WithTransaction(s.TxManager.GetDB(), func(tx *sql.Tx) error {
-		if err := s.ChannelRepo.DeleteAllChannels(tx); err != nil {
-			return err
-		}
-		if err := s.VideoRepo.DeleteAllVideos(tx); err != nil {
-			return err
-		}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return channels, apperrors.Upstream("Failed to fetch the list", err).WithDetails(details)
+	}
+	defer response.Body.Close()
 
-		for _, channel := range videoList.Channels {
-			channelID, err := s.ChannelRepo.InsertChannel(tx, channel.Name)
-			if err != nil {
-				return err
-			}
-			for _, video := range channel.Videos {
-				if err := s.VideoRepo.SaveVideo(tx, channelID, video.Id, video.SectionStart, video.SectionEnd); err != nil {
-					return err
-				}
-			}
-		}
-		return nil // No error, commit
-	})
+	if response.StatusCode != http.StatusOK {
+		details["status"] = response.StatusCode
+		return channels, apperrors.Upstream("Failed to fetch the list", fmt.Errorf("%s returned %s", url, response.Status)).WithDetails(details)
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&channels); err != nil {
+		details["reason"] = err.Error()
+		return channels, apperrors.Validation("The list is not a valid channel list").WithDetails(details)
+	}
+
+	return channels, nil
+}
+
+// LoadChannelList reads a channel list JSON from a file, or downloads it
+// when source is an http(s) URL.
+func LoadChannelList(ctx context.Context, source string) (jsonmodels.ChannelsJson, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return FetchChannelList(ctx, source)
+	}
 
+	var channels jsonmodels.ChannelsJson
+	data, err := os.ReadFile(source)
 	if err != nil {
-		return false, err
+		return channels, err
 	}
 
-	return true, nil
+	err = json.Unmarshal(data, &channels)
+	return channels, err
 }
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/config"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+func TestInvalidateVideo(t *testing.T) {
+	type report struct {
+		reporter string
+		age      time.Duration
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		window    time.Duration
+		earlier   []report
+		reporters []string
+		want      bool
+	}{
+		{name: "below the threshold", threshold: 3, window: time.Hour, reporters: []string{"a", "b"}},
+		{name: "at the threshold", threshold: 3, window: time.Hour, reporters: []string{"a", "b", "c"}, want: true},
+		{name: "single report with a threshold of one", threshold: 1, window: time.Hour, reporters: []string{"a"}, want: true},
+		{name: "reporters count once", threshold: 3, window: time.Hour, reporters: []string{"a", "b", "a", "b", "a"}},
+		{name: "reports within the window", threshold: 3, window: time.Hour, earlier: []report{{"a", 10 * time.Minute}, {"b", 50 * time.Minute}}, reporters: []string{"c"}, want: true},
+		{name: "reports before the window", threshold: 3, window: time.Hour, earlier: []report{{"a", 2 * time.Hour}, {"b", 3 * time.Hour}}, reporters: []string{"c"}},
+		{name: "old report made again", threshold: 3, window: time.Hour, earlier: []report{{"a", 2 * time.Hour}, {"b", 2 * time.Hour}}, reporters: []string{"a", "b", "c"}, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := newTestMediaService(newTestDB(t), &config.Config{InvalidationThreshold: test.threshold, InvalidationWindow: test.window})
+			ctx := auth.WithIdentity(context.Background(), auth.CommandLine)
+			list := jsonmodels.ChannelsJson{Channels: []jsonmodels.ChannelJson{listChannel("News", "news", "1", "aaaaaaaaaaa")}}
+			if _, err := service.ImportChannels(ctx, "", list); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, earlier := range test.earlier {
+				if err := service.VideoRepo.SaveReport(ctx, nil, "aaaaaaaaaaa", earlier.reporter, nil, time.Now().Add(-earlier.age).Unix()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			quarantined := false
+			for i, reporter := range test.reporters {
+				var err error
+				quarantined, err = service.InvalidateVideo(context.Background(), "aaaaaaaaaaa", reporter, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if quarantined && i < len(test.reporters)-1 {
+					t.Fatalf("quarantined after report %d of %d", i+1, len(test.reporters))
+				}
+			}
+			if quarantined != test.want {
+				t.Errorf("got quarantined %v, want %v", quarantined, test.want)
+			}
+
+			videos, err := service.FetchQuarantinedVideos(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(videos) == 1) != test.want {
+				t.Errorf("got %d quarantined videos, want quarantined %v", len(videos), test.want)
+			}
+		})
+	}
+
+	t.Run("unknown video", func(t *testing.T) {
+		service := newTestMediaService(newTestDB(t), &config.Config{InvalidationThreshold: 1, InvalidationWindow: time.Hour})
+		if _, err := service.InvalidateVideo(context.Background(), "zzzzzzzzzzz", "a", nil); !apperrors.Is(err, apperrors.CodeNotFound) {
+			t.Errorf("got %v, want not found", err)
+		}
+	})
+}
+
+func TestGetVideoAt(t *testing.T) {
+	service := newTestMediaService(newTestDB(t), &config.Config{})
+	ctx := auth.WithIdentity(context.Background(), auth.CommandLine)
+
+	// A stream with two highlights, and a clip between and after them: 120
+	// seconds in all
+	news := jsonmodels.ChannelJson{Name: "News", Slug: "news", Videos: []jsonmodels.VideoJson{
+		{Id: "aaaaaaaaaaa", SectionStart: 0, SectionEnd: 60},
+		{Id: "aaaaaaaaaaa", SectionStart: 100, SectionEnd: 130},
+		{Id: "bbbbbbbbbbb", SectionStart: 0, SectionEnd: 30},
+	}}
+	if _, err := service.ImportChannels(ctx, "", jsonmodels.ChannelsJson{Channels: []jsonmodels.ChannelJson{news}}); err != nil {
+		t.Fatal(err)
+	}
+	channel, err := service.FindChannel(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := service.ChannelEntries(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].EntryID == entries[1].EntryID {
+		t.Fatalf("got entries %+v, want one for each section", entries)
+	}
+
+	tests := []struct {
+		at        int64
+		wantEntry int
+		wantStart int
+	}{
+		{at: 0, wantEntry: 0, wantStart: 0},
+		{at: 45, wantEntry: 0, wantStart: 45},
+		{at: 60, wantEntry: 1, wantStart: 100},
+		{at: 75, wantEntry: 1, wantStart: 115},
+		{at: 90, wantEntry: 2, wantStart: 0},
+		{at: 119, wantEntry: 2, wantStart: 29},
+		{at: 120, wantEntry: 0, wantStart: 0},
+		{at: 120*1000 + 61, wantEntry: 1, wantStart: 101},
+	}
+
+	for _, test := range tests {
+		got, err := service.GetVideoAt(ctx, channel, time.Unix(test.at, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := entries[test.wantEntry]
+		if got.EntryID != want.EntryID || got.ID != want.ID || got.SectionStart != test.wantStart || got.SectionEnd != want.SectionEnd {
+			t.Errorf("at %d: got entry %d of %s from %d to %d, want entry %d of %s from %d to %d",
+				test.at, got.EntryID, got.ID, got.SectionStart, got.SectionEnd, want.EntryID, want.ID, test.wantStart, want.SectionEnd)
+		}
+	}
+
+	next := []struct {
+		name  string
+		after func() *dbmodels.ChannelVideo
+		want  int
+	}{
+		{name: "first highlight", after: func() *dbmodels.ChannelVideo { return service.FetchNextVideo(ctx, channel, entries[0].EntryID) }, want: 1},
+		{name: "second highlight", after: func() *dbmodels.ChannelVideo { return service.FetchNextVideo(ctx, channel, entries[1].EntryID) }, want: 2},
+		{name: "last entry", after: func() *dbmodels.ChannelVideo { return service.FetchNextVideo(ctx, channel, entries[2].EntryID) }, want: 0},
+		{name: "video played twice", after: func() *dbmodels.ChannelVideo { return service.FetchNextVideoAfter(ctx, channel, "aaaaaaaaaaa") }, want: 1},
+		{name: "unknown video", after: func() *dbmodels.ChannelVideo { return service.FetchNextVideoAfter(ctx, channel, "zzzzzzzzzzz") }, want: 0},
+	}
+	for _, test := range next {
+		got := test.after()
+		if got == nil || got.EntryID != entries[test.want].EntryID || got.SectionStart != entries[test.want].SectionStart {
+			t.Errorf("after the %s: got %+v, want entry %d", test.name, got, entries[test.want].EntryID)
+		}
+	}
+}
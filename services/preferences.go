@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/db"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+// viewer returns who the lineup preferences of the caller belong to: the
+// signed in user, or the browser with the device token carried by ctx.
+// Without either, ok is false.
+func viewer(ctx context.Context) (userID int, deviceHash string, ok bool) {
+	if identity := auth.FromContext(ctx); identity != nil && identity.UserID != 0 {
+		return identity.UserID, "", true
+	}
+	if device := auth.DeviceFromContext(ctx); device != "" {
+		return 0, auth.Hash(device), true
+	}
+	return 0, "", false
+}
+
+// arrangedChannels returns the lineup of the caller, with the channels that
+// have something to play and aren't rated above their limit, in the order
+// they arranged them. Favorites come first, and channels the caller hasn't
+// placed follow the ones they have in channel number order.
+func (s *MediaService) arrangedChannels(ctx context.Context) ([]dbmodels.Channel, error) {
+	profileID, err := s.activeProfile(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := s.ChannelRepo.FetchAllChannels(ctx, profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	var preferences []dbmodels.LineupPreference
+	if userID, deviceHash, ok := viewer(ctx); ok {
+		preferences, err = s.PreferenceRepo.FetchPreferences(ctx, userID, deviceHash, profileID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	byChannel := make(map[int]dbmodels.LineupPreference, len(preferences))
+	for _, preference := range preferences {
+		byChannel[preference.ChannelID] = preference
+	}
+
+	var placed, rest []dbmodels.Channel
+	for _, channel := range channels {
+		if !s.allowed(ctx, channel.Rating) {
+			continue
+		}
+		preference, found := byChannel[channel.ID]
+		if !found {
+			rest = append(rest, channel)
+			continue
+		}
+		channel.Favorite = preference.Favorite
+		channel.Hidden = preference.Hidden
+		placed = append(placed, channel)
+	}
+	sort.SliceStable(placed, func(i, j int) bool {
+		return byChannel[placed[i].ID].Position < byChannel[placed[j].ID].Position
+	})
+
+	arranged := append(placed, rest...)
+	sort.SliceStable(arranged, func(i, j int) bool {
+		return arranged[i].Favorite && !arranged[j].Favorite
+	})
+
+	return arranged, nil
+}
+
+// FetchLineup returns every channel of the caller's lineup they may watch,
+// including the ones they hid, in the order they arranged them.
+func (s *MediaService) FetchLineup(ctx context.Context) (jsonmodels.LineupJson, error) {
+	channels, err := s.arrangedChannels(ctx)
+	if err != nil {
+		return jsonmodels.LineupJson{}, err
+	}
+
+	lineup := jsonmodels.LineupJson{Channels: []jsonmodels.LineupChannelJson{}}
+	for _, channel := range channels {
+		lineup.Channels = append(lineup.Channels, jsonmodels.LineupChannelJson{
+			Channel:  channel.Slug,
+			Name:     channel.Name,
+			Number:   channel.Number,
+			Favorite: channel.Favorite,
+			Hidden:   channel.Hidden,
+		})
+	}
+	return lineup, nil
+}
+
+// SaveLineup replaces how the caller arranged their lineup and returns it
+// arranged that way. Channels left out of lineup are listed after the ones
+// in it, neither favorite nor hidden.
+func (s *MediaService) SaveLineup(ctx context.Context, lineup jsonmodels.LineupJson) (jsonmodels.LineupJson, error) {
+	userID, deviceHash, ok := viewer(ctx)
+	if !ok {
+		return jsonmodels.LineupJson{}, apperrors.Validation("Sign in or allow cookies to arrange channels")
+	}
+
+	profileID, err := s.activeProfile(ctx)
+	if err != nil {
+		return jsonmodels.LineupJson{}, err
+	}
+
+	var preferences []dbmodels.LineupPreference
+	seen := make(map[int]bool, len(lineup.Channels))
+	for i, entry := range lineup.Channels {
+		channel, err := s.ChannelRepo.FindChannel(ctx, profileID, entry.Channel)
+		if err != nil {
+			return jsonmodels.LineupJson{}, err
+		}
+		if err := s.checkRating(ctx, entry.Channel, channel); err != nil {
+			return jsonmodels.LineupJson{}, err
+		}
+		if seen[channel.ID] {
+			return jsonmodels.LineupJson{}, apperrors.Validation("A channel is listed more than once").WithDetails(map[string]interface{}{"channel": entry.Channel})
+		}
+		seen[channel.ID] = true
+
+		preferences = append(preferences, dbmodels.LineupPreference{
+			ChannelID: channel.ID,
+			Position:  i,
+			Favorite:  entry.Favorite,
+			Hidden:    entry.Hidden,
+		})
+	}
+
+	err = db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		return s.PreferenceRepo.ReplacePreferences(ctx, tx, userID, deviceHash, profileID, preferences)
+	})
+	if err != nil {
+		return jsonmodels.LineupJson{}, err
+	}
+
+	return s.FetchLineup(ctx)
+}
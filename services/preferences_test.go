@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/config"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+func TestLineupPreferences(t *testing.T) {
+	service := newTestMediaService(newTestDB(t), &config.Config{})
+	admin := auth.WithIdentity(context.Background(), auth.CommandLine)
+
+	list := jsonmodels.ChannelsJson{Channels: []jsonmodels.ChannelJson{
+		listChannel("News", "news", "1", "aaaaaaaaaaa"),
+		listChannel("Sports", "sports", "2", "bbbbbbbbbbb"),
+		listChannel("Movies", "movies", "3", "ccccccccccc"),
+		listChannel("Kids", "kids", "4", "ddddddddddd"),
+	}}
+	if _, err := service.ImportChannels(admin, "", list); err != nil {
+		t.Fatal(err)
+	}
+
+	signedIn := make(map[string]context.Context)
+	for _, name := range []string{"anna", "ben"} {
+		id, err := service.UserRepo.SaveUser(admin, dbmodels.User{Name: name, Role: string(auth.RoleViewer)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		signedIn[name] = auth.WithIdentity(context.Background(), &auth.Identity{UserID: id, Name: name, Role: auth.RoleViewer, Method: auth.MethodSession})
+	}
+	viewers := map[string]context.Context{
+		"anna":       signedIn["anna"],
+		"ben":        signedIn["ben"],
+		"tv":         auth.WithDevice(context.Background(), "tv-device-token"),
+		"tablet":     auth.WithDevice(context.Background(), "tablet-device-token"),
+		"anna on tv": auth.WithDevice(signedIn["anna"], "tv-device-token"),
+		"nobody":     context.Background(),
+	}
+	lineup := func(channels ...jsonmodels.LineupChannelJson) *jsonmodels.LineupJson {
+		return &jsonmodels.LineupJson{Channels: channels}
+	}
+
+	steps := []struct {
+		name    string
+		viewer  string
+		save    *jsonmodels.LineupJson
+		wantErr apperrors.Code
+		want    []string
+	}{
+		{name: "nothing arranged yet", viewer: "anna", want: []string{"news", "sports", "movies", "kids"}},
+		{
+			name:   "user arranges their lineup",
+			viewer: "anna",
+			save:   lineup(jsonmodels.LineupChannelJson{Channel: "movies", Hidden: true}, jsonmodels.LineupChannelJson{Channel: "kids"}, jsonmodels.LineupChannelJson{Channel: "2", Favorite: true}),
+			want:   []string{"sports", "kids", "news"},
+		},
+		{name: "other users keep theirs", viewer: "ben", want: []string{"news", "sports", "movies", "kids"}},
+		{name: "devices keep theirs", viewer: "tv", want: []string{"news", "sports", "movies", "kids"}},
+		{
+			name:   "device arranges its lineup",
+			viewer: "tv",
+			save:   lineup(jsonmodels.LineupChannelJson{Channel: "kids", Favorite: true}, jsonmodels.LineupChannelJson{Channel: "news"}),
+			want:   []string{"kids", "news", "sports", "movies"},
+		},
+		{name: "other devices keep theirs", viewer: "tablet", want: []string{"news", "sports", "movies", "kids"}},
+		{name: "signed in user on a device", viewer: "anna on tv", want: []string{"sports", "kids", "news"}},
+		{name: "device after the user signs out", viewer: "tv", want: []string{"kids", "news", "sports", "movies"}},
+		{
+			name:   "saving replaces the arrangement",
+			viewer: "anna",
+			save:   lineup(jsonmodels.LineupChannelJson{Channel: "kids"}),
+			want:   []string{"kids", "news", "sports", "movies"},
+		},
+		{name: "nobody to arrange for", viewer: "nobody", save: lineup(), wantErr: apperrors.CodeValidation, want: []string{"news", "sports", "movies", "kids"}},
+		{
+			name:    "channel listed twice",
+			viewer:  "ben",
+			save:    lineup(jsonmodels.LineupChannelJson{Channel: "news"}, jsonmodels.LineupChannelJson{Channel: "1"}),
+			wantErr: apperrors.CodeValidation,
+			want:    []string{"news", "sports", "movies", "kids"},
+		},
+		{
+			name:    "unknown channel",
+			viewer:  "ben",
+			save:    lineup(jsonmodels.LineupChannelJson{Channel: "weather", Favorite: true}),
+			wantErr: apperrors.CodeNotFound,
+			want:    []string{"news", "sports", "movies", "kids"},
+		},
+	}
+
+	for _, step := range steps {
+		ctx := viewers[step.viewer]
+		if step.save != nil {
+			_, err := service.SaveLineup(ctx, *step.save)
+			if step.wantErr == "" && err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			if step.wantErr != "" && !apperrors.Is(err, step.wantErr) {
+				t.Errorf("%s gave %v, want %s", step.name, err, step.wantErr)
+			}
+		}
+
+		channels, err := service.FetchAllChannels(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, channel := range channels {
+			got = append(got, channel.Slug)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got channels %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	// Hidden channels are left out of the channel list but not the lineup
+	arranged, err := service.SaveLineup(viewers["ben"], *lineup(jsonmodels.LineupChannelJson{Channel: "news", Hidden: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arranged.Channels) != 4 || arranged.Channels[0].Channel != "news" || !arranged.Channels[0].Hidden {
+		t.Errorf("got lineup %+v, want every channel with news hidden first", arranged.Channels)
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/helpers"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// pinPattern matches the PINs profiles can be locked with.
+var pinPattern = regexp.MustCompile(`^[0-9]{4,8}$`)
+
+// After maxPinFailures wrong PINs in a row for a profile, or from a client,
+// switching is refused for pinLockout, doubling with every lockout after
+// that up to maxPinLockout. That keeps a 4 digit PIN from being guessed.
+const (
+	maxPinFailures = 5
+	pinLockout     = time.Minute
+	maxPinLockout  = 24 * time.Hour
+)
+
+// isProfile reports whether user is a viewer profile, one that can be
+// switched to without a password: a viewer with a max rating or a PIN.
+func isProfile(user dbmodels.User) bool {
+	return user.Role == string(auth.RoleViewer) && (user.MaxRating != "" || user.PinHash != "")
+}
+
+// ListProfiles returns the viewer profiles, for picking one on a shared TV.
+func (s *AuthService) ListProfiles(ctx context.Context) ([]dbmodels.User, error) {
+	users, err := s.UserRepo.FetchUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := []dbmodels.User{}
+	for _, user := range users {
+		if isProfile(user) {
+			profiles = append(profiles, user)
+		}
+	}
+	return profiles, nil
+}
+
+// SwitchProfile starts a web UI session for the viewer profile name,
+// returning its ID and when it expires. Profiles locked with a PIN need it,
+// the others can be switched to by anyone. client identifies who is asking,
+// so guessing PINs can be throttled per client as well as per profile.
+func (s *AuthService) SwitchProfile(ctx context.Context, name string, pin string, client string) (string, time.Time, error) {
+	user, err := s.UserRepo.FindUserByName(ctx, strings.TrimSpace(name))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if user == nil || !isProfile(*user) {
+		return "", time.Time{}, apperrors.NotFound("Profile not found").WithDetails(map[string]interface{}{"profile": name})
+	}
+
+	if user.PinHash != "" {
+		keys := []string{"profile:" + user.Name, "client:" + client}
+		if wait := s.pins.wait(keys...); wait > 0 {
+			return "", time.Time{}, apperrors.TooManyRequests("Too many wrong PINs, try again later").WithDetails(map[string]interface{}{"retry_after_seconds": int(wait.Seconds()) + 1})
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PinHash), []byte(pin)); err != nil {
+			s.pins.fail(keys...)
+			return "", time.Time{}, apperrors.Unauthenticated("Wrong PIN")
+		}
+		s.pins.succeed(keys...)
+	}
+
+	return s.startSession(ctx, &user.ID, user.Name)
+}
+
+// SetMaxRating sets the highest content rating the user name may watch, or
+// removes the limit when rating is empty. Only admins may do that.
+func (s *AuthService) SetMaxRating(ctx context.Context, name string, rating string) error {
+	user, err := s.FindUser(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	user.MaxRating, err = parseMaxRating(rating)
+	if err != nil {
+		return err
+	}
+	return s.UserRepo.UpdateUser(ctx, *user)
+}
+
+// SetPIN locks the user name with a PIN of 4 to 8 digits, or unlocks them
+// when pin is empty. Only admins may do that.
+func (s *AuthService) SetPIN(ctx context.Context, name string, pin string) error {
+	user, err := s.FindUser(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	user.PinHash, err = hashPIN(pin)
+	if err != nil {
+		return err
+	}
+	return s.UserRepo.UpdateUser(ctx, *user)
+}
+
+// parseMaxRating normalizes a max rating, keeping it empty for no limit.
+func parseMaxRating(rating string) (string, error) {
+	if rating == "" {
+		return "", nil
+	}
+
+	normalized, ok := helpers.NormalizeRating(rating)
+	if !ok {
+		return "", apperrors.Validation("Unknown content rating, use G, PG, PG-13, R, NC-17 or an age").WithDetails(map[string]interface{}{"rating": rating})
+	}
+	return normalized, nil
+}
+
+// hashPIN returns the hash to store for pin, or an empty one for no PIN.
+func hashPIN(pin string) (string, error) {
+	if pin == "" {
+		return "", nil
+	}
+	if !pinPattern.MatchString(pin) {
+		return "", apperrors.Validation("A PIN has 4 to 8 digits")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	return string(hash), err
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+func TestThrottle(t *testing.T) {
+	const lockout = time.Hour
+
+	tests := []struct {
+		name     string
+		failures int
+		succeed  bool
+		want     time.Duration
+	}{
+		{name: "below the limit", failures: 2, want: 0},
+		{name: "first lockout", failures: 3, want: lockout},
+		{name: "failures after a lockout count again", failures: 5, want: lockout},
+		{name: "second lockout doubles", failures: 6, want: 2 * lockout},
+		{name: "third lockout doubles again", failures: 9, want: 4 * lockout},
+		{name: "lockouts are capped", failures: 30, want: 5 * lockout},
+		{name: "success clears the lockout", failures: 6, succeed: true, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			throttle := newThrottle(3, lockout, 5*lockout)
+			for i := 0; i < test.failures; i++ {
+				throttle.fail("profile:kids", "client:a")
+			}
+			if test.succeed {
+				throttle.succeed("profile:kids", "client:a")
+			}
+
+			got := throttle.wait("profile:kids")
+			if got > test.want || got < test.want-time.Minute {
+				t.Errorf("waiting %s, want %s", got, test.want)
+			}
+			if other := throttle.wait("profile:teens", "client:b"); other != 0 {
+				t.Errorf("other keys wait %s, want 0", other)
+			}
+		})
+	}
+
+	t.Run("longest of several keys", func(t *testing.T) {
+		throttle := newThrottle(3, lockout, 5*lockout)
+		for i := 0; i < 6; i++ {
+			throttle.fail("client:a")
+		}
+		for i := 0; i < 3; i++ {
+			throttle.fail("profile:kids")
+		}
+		if got := throttle.wait("profile:kids", "client:a"); got <= lockout {
+			t.Errorf("waiting %s, want the %s of the client", got, 2*lockout)
+		}
+	})
+}
+
+func TestSwitchProfile(t *testing.T) {
+	service := newTestAuthService(newTestDB(t))
+	admin := auth.WithIdentity(context.Background(), auth.CommandLine)
+	for _, name := range []string{"kids", "teens"} {
+		pin, rating := "1234", "PG"
+		if _, err := service.SaveUser(admin, jsonmodels.UserRequestJson{Name: name, MaxRating: &rating, Pin: &pin}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	free := "G"
+	if _, err := service.SaveUser(admin, jsonmodels.UserRequestJson{Name: "toddlers", MaxRating: &free}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.SaveUser(admin, jsonmodels.UserRequestJson{Name: "parents", Role: "admin", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	switchTo := func(name string, pin string, client string) error {
+		sessionID, _, err := service.SwitchProfile(ctx, name, pin, client)
+		if err == nil && sessionID == "" {
+			return fmt.Errorf("no session")
+		}
+		return err
+	}
+
+	if err := switchTo("toddlers", "", "tv"); err != nil {
+		t.Errorf("switching to a profile without a PIN: %v", err)
+	}
+	if err := switchTo("parents", "", "tv"); !apperrors.Is(err, apperrors.CodeNotFound) {
+		t.Errorf("switching to an admin gave %v, want not found", err)
+	}
+	if err := switchTo("kids", "1234", "tv"); err != nil {
+		t.Errorf("switching with the right PIN: %v", err)
+	}
+
+	for i := 1; i <= maxPinFailures; i++ {
+		if err := switchTo("kids", "0000", "tablet"); !apperrors.Is(err, apperrors.CodeUnauthenticated) {
+			t.Fatalf("wrong PIN %d gave %v, want unauthenticated", i, err)
+		}
+	}
+
+	steps := []struct {
+		name    string
+		profile string
+		pin     string
+		client  string
+		want    apperrors.Code
+	}{
+		{name: "right PIN while the profile is locked out", profile: "kids", pin: "1234", client: "tv", want: apperrors.CodeTooManyRequests},
+		{name: "other profile from the locked out client", profile: "teens", pin: "1234", client: "tablet", want: apperrors.CodeTooManyRequests},
+		{name: "other profile from another client", profile: "teens", pin: "1234", client: "tv"},
+		{name: "profile without a PIN from the locked out client", profile: "toddlers", client: "tablet"},
+	}
+	for _, step := range steps {
+		err := switchTo(step.profile, step.pin, step.client)
+		if step.want == "" && err != nil {
+			t.Errorf("%s: %v", step.name, err)
+		}
+		if step.want != "" && !apperrors.Is(err, step.want) {
+			t.Errorf("%s gave %v, want %s", step.name, err, step.want)
+		}
+	}
+
+	_, _, err := service.SwitchProfile(ctx, "kids", "1234", "tv")
+	if !apperrors.Is(err, apperrors.CodeTooManyRequests) || apperrors.From(err, "").Details["retry_after_seconds"] == nil {
+		t.Errorf("lockout error %v says nothing about when to retry", err)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/helpers"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+)
+
+// allowed reports whether the caller may watch content with rating. Users
+// are limited by the max rating of their profile, or by DefaultMaxRating
+// when they have none, like visitors who aren't signed in. Admins without a
+// max rating of their own aren't limited, so they see every channel they
+// manage. Unrated content is allowed for everyone.
+func (s *MediaService) allowed(ctx context.Context, rating string) bool {
+	maxRating := s.Config.DefaultMaxRating
+	if identity := auth.FromContext(ctx); identity != nil {
+		if identity.MaxRating != "" {
+			maxRating = identity.MaxRating
+		} else if identity.Role.Includes(auth.RoleAdmin) {
+			maxRating = ""
+		}
+	}
+	if maxRating == "" || rating == "" {
+		return true
+	}
+
+	return helpers.RatingAge(rating) <= helpers.RatingAge(maxRating)
+}
+
+// checkRating refuses the channel the caller referred to as ref if it is
+// rated above their limit.
+func (s *MediaService) checkRating(ctx context.Context, ref string, channel *dbmodels.Channel) error {
+	if s.allowed(ctx, channel.Rating) {
+		return nil
+	}
+	return apperrors.Forbidden("This channel is rated above the limit of your profile").WithDetails(map[string]interface{}{"channel": ref, "rating": channel.Rating})
+}
+
+// entryRating returns the rating of an entry, which is the one of its
+// channel unless it has its own.
+func entryRating(channel *dbmodels.Channel, entry *dbmodels.ChannelVideo) string {
+	if entry.Rating != "" {
+		return entry.Rating
+	}
+	return channel.Rating
+}
+
+// fillIn replaces an entry the caller may not watch with filler of the same
+// length, so the rest of the schedule stays in step with everyone else.
+// Entries without a rating of their own have the rating of their channel.
+func (s *MediaService) fillIn(ctx context.Context, channel *dbmodels.Channel, entry *dbmodels.ChannelVideo) *dbmodels.ChannelVideo {
+	if entry == nil {
+		return nil
+	}
+
+	if !s.allowed(ctx, entryRating(channel, entry)) {
+		entry.Video = dbmodels.Video{Source: dbmodels.VideoSourceFiller}
+	}
+
+	return entry
+}
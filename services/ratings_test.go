@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/config"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+)
+
+func TestFillIn(t *testing.T) {
+	kids := &auth.Identity{UserID: 1, Name: "kids", Role: auth.RoleViewer, MaxRating: "PG", Method: auth.MethodSession}
+	viewer := &auth.Identity{UserID: 2, Name: "guest", Role: auth.RoleViewer, Method: auth.MethodSession}
+	admin := &auth.Identity{UserID: 3, Name: "parents", Role: auth.RoleAdmin, Method: auth.MethodSession}
+
+	tests := []struct {
+		name             string
+		defaultMaxRating string
+		identity         *auth.Identity
+		channelRating    string
+		entryRating      string
+		wantFiller       bool
+	}{
+		{name: "visitor without a default limit", identity: nil, entryRating: "R"},
+		{name: "visitor above the default limit", defaultMaxRating: "PG", identity: nil, entryRating: "R", wantFiller: true},
+		{name: "visitor within the default limit", defaultMaxRating: "PG-13", identity: nil, entryRating: "PG"},
+		{name: "profile above its limit", identity: kids, entryRating: "PG-13", wantFiller: true},
+		{name: "profile within its limit", identity: kids, entryRating: "G"},
+		{name: "profile limit wins over the default", defaultMaxRating: "R", identity: kids, entryRating: "R", wantFiller: true},
+		{name: "entry rated like its channel", identity: kids, channelRating: "R", wantFiller: true},
+		{name: "entry rating wins over its channel", identity: kids, channelRating: "R", entryRating: "G"},
+		{name: "unrated entry", defaultMaxRating: "G", identity: kids},
+		{name: "user without a limit gets the default", defaultMaxRating: "PG", identity: viewer, entryRating: "R", wantFiller: true},
+		{name: "admin without a limit ignores the default", defaultMaxRating: "PG", identity: admin, entryRating: "R"},
+		{name: "age ratings", defaultMaxRating: "12", identity: nil, entryRating: "16", wantFiller: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &MediaService{Config: &config.Config{DefaultMaxRating: test.defaultMaxRating}}
+			ctx := context.Background()
+			if test.identity != nil {
+				ctx = auth.WithIdentity(ctx, test.identity)
+			}
+
+			channel := &dbmodels.Channel{ID: 1, Name: "Movies", Rating: test.channelRating}
+			entry := &dbmodels.ChannelVideo{
+				EntryID:      7,
+				SectionStart: 30,
+				SectionEnd:   90,
+				Rating:       test.entryRating,
+				Video:        dbmodels.Video{ID: "dQw4w9WgXcQ", Source: dbmodels.VideoSourceYouTube},
+			}
+
+			got := service.fillIn(ctx, channel, entry)
+			if filler := got.Source == dbmodels.VideoSourceFiller; filler != test.wantFiller {
+				t.Errorf("got source %q, want filler %v", got.Source, test.wantFiller)
+			}
+			if test.wantFiller && got.ID != "" {
+				t.Errorf("filler still names video %q", got.ID)
+			}
+			if got.EntryID != 7 || got.SectionStart != 30 || got.SectionEnd != 90 {
+				t.Errorf("got entry %d from %d to %d, want the slot of the entry it replaces", got.EntryID, got.SectionStart, got.SectionEnd)
+			}
+		})
+	}
+
+	if got := (&MediaService{Config: &config.Config{}}).fillIn(context.Background(), &dbmodels.Channel{}, nil); got != nil {
+		t.Errorf("got %+v for no entry, want nil", got)
+	}
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/db"
+	"github.com/ozencb/couchtube/helpers"
+	"github.com/ozencb/couchtube/metrics"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+	repo "github.com/ozencb/couchtube/repositories"
+)
+
+const (
+	SyncModeInitial   = "initial"
+	SyncModeReconcile = "reconcile"
+	SyncModeWipe      = "wipe"
+)
+
+// SyncSummary counts what a reconcile changed.
+type SyncSummary struct {
+	Added         int
+	Updated       int
+	Removed       int
+	Unchanged     int
+	VideosRemoved int
+}
+
+func (s SyncSummary) String() string {
+	return fmt.Sprintf("%d channels added, %d updated, %d removed, %d unchanged; %d videos removed",
+		s.Added, s.Updated, s.Removed, s.Unchanged, s.VideosRemoved)
+}
+
+// SyncFromFile applies the channel list at path to the database according to
+// mode. Library channels are left alone.
+func (s *MediaService) SyncFromFile(ctx context.Context, path string, mode string) error {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return err
+	}
+
+	switch mode {
+	case SyncModeInitial, SyncModeReconcile, SyncModeWipe:
+	default:
+		return fmt.Errorf("unknown sync mode %q", mode)
+	}
+
+	channels, err := helpers.LoadJSONFromFile[jsonmodels.ChannelsJson](path)
+	if err != nil {
+		return err
+	}
+
+	if mode == SyncModeInitial {
+		exists, err := s.ChannelRepo.HasChannels(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if exists {
+			s.Logger.Info("Data already exists in the database. Skipping population.")
+			// Databases created before slugs existed still need them
+			return db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+				return assignMissingSlugs(ctx, tx, s.ChannelRepo)
+			})
+		}
+	}
+
+	if mode == SyncModeWipe {
+		s.Logger.Warn("Wipe sync enabled. Deleting all data from the database.")
+		if err := db.WipeTables(s.TxManager.GetDB()); err != nil {
+			return err
+		}
+	}
+
+	summary, err := s.ImportChannels(ctx, "", channels)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info("Channel list synced", "path", path, "summary", summary.String())
+	return nil
+}
+
+// ImportChannels replaces the list channels of the lineup of the user named
+// profile, or of the shared lineup when it is empty, with channels, keeping
+// the IDs, slugs and numbers of channels that are still there. Channels built
+// from the media library and by curators are left alone. Only admins may
+// import.
+func (s *MediaService) ImportChannels(ctx context.Context, profile string, channels jsonmodels.ChannelsJson) (summary SyncSummary, err error) {
+	if _, err := auth.Require(ctx, auth.RoleAdmin); err != nil {
+		return summary, err
+	}
+
+	profileID, err := s.profileID(ctx, profile)
+	if err != nil {
+		return summary, err
+	}
+
+	defer func(start time.Time) {
+		metrics.ObserveImport("list", start, err)
+	}(time.Now())
+
+	err = db.WithTransaction(ctx, s.TxManager.GetDB(), func(tx *sql.Tx) error {
+		var err error
+		summary, err = s.reconcileChannels(ctx, tx, profileID, channels)
+		return err
+	})
+
+	return summary, err
+}
+
+// reconcileChannels makes the list channels in the lineup of profileID match
+// channels. Channels are matched by slug, then by name, and keep their ID as
+// long as one of them stays the same. A channel's lineup is only rewritten
+// when its entries differ. Channels named like a library or curated channel
+// are skipped rather than taking it over, and slugs and numbers they use are
+// dropped. A list left without any channel to import is refused, leaving the
+// lineup alone.
+func (s *MediaService) reconcileChannels(ctx context.Context, tx *sql.Tx, profileID int, channels jsonmodels.ChannelsJson) (SyncSummary, error) {
+	var summary SyncSummary
+
+	all, err := s.ChannelRepo.FetchChannels(ctx, tx)
+	if err != nil {
+		return summary, err
+	}
+	all = inLineup(all, profileID)
+
+	wanted, problems := wantedChannels(channels)
+	wanted, clashes := withoutClashes(wanted, all)
+	problems = append(problems, clashes...)
+	for _, problem := range problems {
+		s.Logger.Warn("Channel list problem", "error", problem)
+	}
+
+	// A list without a single usable channel is far more likely broken than
+	// meant to remove every channel
+	if len(wanted) == 0 {
+		reasons := make([]string, 0, len(problems))
+		for _, problem := range problems {
+			reasons = append(reasons, problem.Error())
+		}
+		return summary, apperrors.Validation("The list has no channels that can be imported").WithDetails(map[string]interface{}{"problems": reasons})
+	}
+
+	// Pair up the wanted channels with the list channels they replace
+	existing := make(map[int]dbmodels.Channel)
+	for _, channel := range all {
+		if channel.Source == dbmodels.ChannelSourceList {
+			existing[channel.ID] = channel
+		}
+	}
+	matches := make([]int, len(wanted))
+	for i, channel := range wanted {
+		matches[i] = matchChannel(existing, func(c dbmodels.Channel) bool { return c.Slug != "" && c.Slug == channel.Slug })
+		if matches[i] == 0 {
+			matches[i] = matchChannel(existing, func(c dbmodels.Channel) bool { return c.Name == channel.Name })
+		}
+		delete(existing, matches[i])
+	}
+
+	for _, channel := range existing {
+		if err := s.ChannelRepo.DeleteChannel(ctx, tx, channel.ID); err != nil {
+			return summary, err
+		}
+		summary.Removed++
+	}
+
+	// Release the names, slugs and numbers that are about to change hands
+	// first, so channels can swap them without tripping the unique indexes.
+	// Only list channels hold them, since the ones of other channels were
+	// left out of wanted above. Every released channel gets its new values
+	// below.
+	claimed := make(map[string]bool)
+	names := make(map[string]int, len(wanted))
+	for i, channel := range wanted {
+		names[channel.Name] = matches[i]
+		if channel.Slug != "" {
+			claimed["slug:"+channel.Slug] = true
+		}
+		if channel.Number != "" {
+			claimed["number:"+channel.Number.String()] = true
+		}
+	}
+	for _, channel := range all {
+		if _, removed := existing[channel.ID]; removed || channel.Source != dbmodels.ChannelSourceList {
+			continue
+		}
+		release := false
+		if claimed["slug:"+channel.Slug] || claimed["number:"+channel.Number] {
+			channel.Slug, channel.Number = "", ""
+			release = true
+		}
+		if id, ok := names[channel.Name]; ok && id != channel.ID {
+			channel.Name = fmt.Sprintf("~released-%d", channel.ID)
+			release = true
+		}
+		if release {
+			if err := s.ChannelRepo.UpdateChannel(ctx, tx, channel); err != nil {
+				return summary, err
+			}
+		}
+	}
+
+	byID := make(map[int]dbmodels.Channel, len(all))
+	for _, channel := range all {
+		byID[channel.ID] = channel
+	}
+
+	for i, channel := range wanted {
+		row := dbmodels.Channel{
+			ID:     matches[i],
+			Slug:   channel.Slug,
+			Number: channel.Number.String(),
+			Name:   channel.Name,
+			Rating: string(channel.Rating),
+			Source: dbmodels.ChannelSourceList,
+		}
+		if profileID != 0 {
+			row.ProfileID = &profileID
+		}
+
+		if row.ID == 0 {
+			channelID, err := s.ChannelRepo.CreateChannel(ctx, tx, row)
+			if err != nil {
+				return summary, err
+			}
+			if err := s.saveEntries(ctx, tx, channelID, channel.entries); err != nil {
+				return summary, err
+			}
+			summary.Added++
+			continue
+		}
+
+		// Slugs and numbers were cleared above if they are changing, so
+		// they always need to be written back
+		if err := s.ChannelRepo.UpdateChannel(ctx, tx, row); err != nil {
+			return summary, err
+		}
+
+		current, err := s.VideoRepo.GetChannelEntries(ctx, tx, row.ID)
+		if err != nil {
+			return summary, err
+		}
+		previous := byID[row.ID]
+		if sameEntries(current, channel.entries) {
+			if previous.Name == row.Name && previous.Slug == row.Slug && previous.Number == row.Number && previous.Rating == row.Rating {
+				summary.Unchanged++
+			} else {
+				summary.Updated++
+			}
+			continue
+		}
+
+		if err := s.VideoRepo.DeleteChannelVideos(ctx, tx, row.ID); err != nil {
+			return summary, err
+		}
+		if err := s.saveEntries(ctx, tx, row.ID, channel.entries); err != nil {
+			return summary, err
+		}
+		summary.Updated++
+	}
+
+	summary.VideosRemoved, err = s.VideoRepo.DeleteOrphanVideos(ctx, tx)
+	if err != nil {
+		return summary, err
+	}
+
+	return summary, assignMissingSlugs(ctx, tx, s.ChannelRepo)
+}
+
+type wantedChannel struct {
+	jsonmodels.ChannelJson
+	entries []dbmodels.ChannelVideo
+}
+
+// wantedChannels validates channels and drops the ones that can't be
+// imported, such as duplicates or channels without a playable video. It
+// returns everything that was dropped as problems.
+func wantedChannels(channels jsonmodels.ChannelsJson) ([]wantedChannel, []error) {
+	var wanted []wantedChannel
+	var problems []error
+	seen := make(map[string]bool)
+
+	for _, channel := range channels.Channels {
+		if err := channel.Normalize(); err != nil {
+			problems = append(problems, fmt.Errorf("skipping channel: %w", err))
+			continue
+		}
+		if seen["name:"+channel.Name] || seen["slug:"+channel.Slug] || (channel.Number != "" && seen["number:"+channel.Number.String()]) {
+			problems = append(problems, fmt.Errorf("skipping channel %s: it reuses the name, slug or number of another channel", channel.Name))
+			continue
+		}
+
+		entries := make([]dbmodels.ChannelVideo, 0, len(channel.Videos))
+		for _, video := range channel.Videos {
+			if err := video.Normalize(); err != nil {
+				problems = append(problems, fmt.Errorf("skipping video in channel %s: %w", channel.Name, err))
+				continue
+			}
+			entries = append(entries, dbmodels.ChannelVideo{
+				SectionStart: video.SectionStart,
+				SectionEnd:   video.SectionEnd,
+				Rating:       string(video.Rating),
+				Video:        dbmodels.Video{ID: video.Id, Source: video.Source, URL: video.Url},
+			})
+		}
+		if len(entries) == 0 {
+			// Treated like a channel missing from the file, so it is removed
+			problems = append(problems, fmt.Errorf("skipping channel %s: it has no videos", channel.Name))
+			continue
+		}
+
+		seen["name:"+channel.Name] = true
+		seen["slug:"+channel.Slug] = true
+		if channel.Number != "" {
+			seen["number:"+channel.Number.String()] = true
+		}
+		wanted = append(wanted, wantedChannel{ChannelJson: channel, entries: entries})
+	}
+
+	return wanted, problems
+}
+
+// withoutClashes drops the wanted channels named like a library or curated
+// channel in the same lineup, and clears the slugs and numbers such channels
+// already use, since an import must not take them over. It returns
+// everything it dropped or changed as problems.
+func withoutClashes(wanted []wantedChannel, lineup []dbmodels.Channel) ([]wantedChannel, []error) {
+	taken := make(map[string]dbmodels.Channel)
+	for _, channel := range lineup {
+		if channel.Source == dbmodels.ChannelSourceList {
+			continue
+		}
+		taken["name:"+channel.Name] = channel
+		if channel.Slug != "" {
+			taken["slug:"+channel.Slug] = channel
+		}
+		if channel.Number != "" {
+			taken["number:"+channel.Number] = channel
+		}
+	}
+
+	var kept []wantedChannel
+	var problems []error
+	for _, channel := range wanted {
+		if other, ok := taken["name:"+channel.Name]; ok {
+			problems = append(problems, fmt.Errorf("skipping channel %s: it has the name of a %s channel", channel.Name, other.Source))
+			continue
+		}
+		if other, ok := taken["slug:"+channel.Slug]; ok {
+			problems = append(problems, fmt.Errorf("channel %s gets a new slug: %s is used by %s channel %s", channel.Name, channel.Slug, other.Source, other.Name))
+			channel.Slug = ""
+		}
+		if other, ok := taken["number:"+channel.Number.String()]; ok && channel.Number != "" {
+			problems = append(problems, fmt.Errorf("channel %s has no number: %s is used by %s channel %s", channel.Name, channel.Number, other.Source, other.Name))
+			channel.Number = ""
+		}
+		kept = append(kept, channel)
+	}
+
+	return kept, problems
+}
+
+// ValidateChannels returns the problems that would make an import skip
+// channels or videos.
+func ValidateChannels(channels jsonmodels.ChannelsJson) []error {
+	_, problems := wantedChannels(channels)
+	return problems
+}
+
+func matchChannel(existing map[int]dbmodels.Channel, match func(dbmodels.Channel) bool) int {
+	for id, channel := range existing {
+		if match(channel) {
+			return id
+		}
+	}
+	return 0
+}
+
+func (s *MediaService) saveEntries(ctx context.Context, tx *sql.Tx, channelID int, entries []dbmodels.ChannelVideo) error {
+	for _, entry := range entries {
+		if err := s.VideoRepo.SaveVideo(ctx, tx, channelID, entry.Video, entry.SectionStart, entry.SectionEnd, entry.Rating); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignMissingSlugs gives every channel without a slug one derived from its
+// name, adding a numeric suffix when that slug is already taken in the
+// channel's lineup.
+func assignMissingSlugs(ctx context.Context, tx *sql.Tx, channelRepo repo.ChannelRepository) error {
+	channels, err := channelRepo.FetchChannels(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	taken := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		taken[lineupKey(channel)+channel.Slug] = true
+	}
+
+	for _, channel := range channels {
+		if channel.Slug != "" {
+			continue
+		}
+
+		base := helpers.Slugify(channel.Name)
+		channel.Slug = base
+		for n := 2; taken[lineupKey(channel)+channel.Slug]; n++ {
+			channel.Slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[lineupKey(channel)+channel.Slug] = true
+
+		if err := channelRepo.UpdateChannel(ctx, tx, channel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sameEntries(current []dbmodels.ChannelVideo, wanted []dbmodels.ChannelVideo) bool {
+	if len(current) != len(wanted) {
+		return false
+	}
+
+	for i := range current {
+		a, b := current[i], wanted[i]
+		if a.ID != b.ID || a.Source != b.Source || a.URL != b.URL ||
+			a.SectionStart != b.SectionStart || a.SectionEnd != b.SectionEnd || a.Rating != b.Rating {
+			return false
+		}
+	}
+
+	return true
+}
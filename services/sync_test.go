@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ozencb/couchtube/apperrors"
+	"github.com/ozencb/couchtube/auth"
+	"github.com/ozencb/couchtube/config"
+	dbmodels "github.com/ozencb/couchtube/models/db"
+	jsonmodels "github.com/ozencb/couchtube/models/json"
+)
+
+// listChannel returns a channel of a channel list with a minute of each of
+// videos.
+func listChannel(name string, slug string, number string, videos ...string) jsonmodels.ChannelJson {
+	channel := jsonmodels.ChannelJson{Name: name, Slug: slug, Number: json.Number(number)}
+	for _, id := range videos {
+		channel.Videos = append(channel.Videos, jsonmodels.VideoJson{Id: id, SectionStart: 0, SectionEnd: 60})
+	}
+	return channel
+}
+
+type channelState struct {
+	slug   string
+	number string
+	source string
+}
+
+func TestImportChannels(t *testing.T) {
+	service := newTestMediaService(newTestDB(t), &config.Config{})
+	ctx := auth.WithIdentity(context.Background(), auth.CommandLine)
+
+	if _, err := service.ChannelRepo.SaveChannel(ctx, nil, dbmodels.Channel{Name: "Shows", Slug: "shows", Number: "7", Source: dbmodels.ChannelSourceLibrary}); err != nil {
+		t.Fatal(err)
+	}
+	library := channelState{slug: "shows", number: "7", source: dbmodels.ChannelSourceLibrary}
+
+	steps := []struct {
+		name     string
+		channels []jsonmodels.ChannelJson
+		want     SyncSummary
+		wantErr  apperrors.Code
+		// lineup is every channel by name after the import, and keeps the
+		// channels that must have kept the ID of the one they are mapped to
+		lineup map[string]channelState
+		keeps  map[string]string
+	}{
+		{
+			name: "add",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("News", "news", "1", "aaaaaaaaaaa"),
+				listChannel("Sports", "", "2", "bbbbbbbbbbb"),
+			},
+			want: SyncSummary{Added: 2},
+			lineup: map[string]channelState{
+				"News":   {slug: "news", number: "1", source: "list"},
+				"Sports": {slug: "sports", number: "2", source: "list"},
+				"Shows":  library,
+			},
+		},
+		{
+			name: "unchanged",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("News", "news", "1", "aaaaaaaaaaa"),
+				listChannel("Sports", "", "2", "bbbbbbbbbbb"),
+			},
+			want: SyncSummary{Unchanged: 2},
+			lineup: map[string]channelState{
+				"News":   {slug: "news", number: "1", source: "list"},
+				"Sports": {slug: "sports", number: "2", source: "list"},
+				"Shows":  library,
+			},
+			keeps: map[string]string{"News": "News", "Sports": "Sports"},
+		},
+		{
+			name: "renamed channel is matched by slug",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("World News", "news", "1", "aaaaaaaaaaa"),
+				listChannel("Sports", "", "2", "bbbbbbbbbbb"),
+			},
+			want: SyncSummary{Updated: 1, Unchanged: 1},
+			lineup: map[string]channelState{
+				"World News": {slug: "news", number: "1", source: "list"},
+				"Sports":     {slug: "sports", number: "2", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "News", "Sports": "Sports"},
+		},
+		{
+			name: "channel with a new slug is matched by name",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("World News", "world", "1", "aaaaaaaaaaa"),
+				listChannel("Sports", "", "2", "bbbbbbbbbbb"),
+			},
+			want: SyncSummary{Updated: 1, Unchanged: 1},
+			lineup: map[string]channelState{
+				"World News": {slug: "world", number: "1", source: "list"},
+				"Sports":     {slug: "sports", number: "2", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "World News", "Sports": "Sports"},
+		},
+		{
+			name: "new entries",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("World News", "world", "1", "aaaaaaaaaaa"),
+				listChannel("Sports", "", "2", "bbbbbbbbbbb", "ccccccccccc"),
+			},
+			want: SyncSummary{Updated: 1, Unchanged: 1},
+			lineup: map[string]channelState{
+				"World News": {slug: "world", number: "1", source: "list"},
+				"Sports":     {slug: "sports", number: "2", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "World News", "Sports": "Sports"},
+		},
+		{
+			name: "channels swap numbers",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("World News", "world", "2", "aaaaaaaaaaa"),
+				listChannel("Sports", "", "1", "bbbbbbbbbbb", "ccccccccccc"),
+			},
+			want: SyncSummary{Updated: 2},
+			lineup: map[string]channelState{
+				"World News": {slug: "world", number: "2", source: "list"},
+				"Sports":     {slug: "sports", number: "1", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "World News", "Sports": "Sports"},
+		},
+		{
+			name: "channels swap slugs",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("World News", "sports", "2", "aaaaaaaaaaa"),
+				listChannel("Sports", "world", "1", "bbbbbbbbbbb", "ccccccccccc"),
+			},
+			want: SyncSummary{Updated: 2},
+			lineup: map[string]channelState{
+				"World News": {slug: "sports", number: "2", source: "list"},
+				"Sports":     {slug: "world", number: "1", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "Sports", "Sports": "World News"},
+		},
+		{
+			name: "library channels keep their name, slug and number",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("World News", "sports", "2", "aaaaaaaaaaa"),
+				listChannel("Sports", "world", "1", "bbbbbbbbbbb", "ccccccccccc"),
+				listChannel("Shows", "tv-shows", "", "ddddddddddd"),
+				listChannel("Cartoons", "shows", "7", "eeeeeeeeeee"),
+			},
+			want: SyncSummary{Added: 1, Unchanged: 2},
+			lineup: map[string]channelState{
+				"World News": {slug: "sports", number: "2", source: "list"},
+				"Sports":     {slug: "world", number: "1", source: "list"},
+				"Cartoons":   {slug: "cartoons", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "World News", "Sports": "Sports", "Shows": "Shows"},
+		},
+		{
+			name: "remove",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("World News", "sports", "2", "aaaaaaaaaaa"),
+			},
+			want: SyncSummary{Removed: 2, Unchanged: 1, VideosRemoved: 3},
+			lineup: map[string]channelState{
+				"World News": {slug: "sports", number: "2", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "World News", "Shows": "Shows"},
+		},
+		{
+			name: "list without a usable channel is refused",
+			channels: []jsonmodels.ChannelJson{
+				listChannel("Weather", "", ""),
+				listChannel("", "", "", "fffffffffff"),
+				listChannel("Shows", "", "", "fffffffffff"),
+			},
+			wantErr: apperrors.CodeValidation,
+			lineup: map[string]channelState{
+				"World News": {slug: "sports", number: "2", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "World News", "Shows": "Shows"},
+		},
+		{
+			name:     "empty list is refused",
+			channels: nil,
+			wantErr:  apperrors.CodeValidation,
+			lineup: map[string]channelState{
+				"World News": {slug: "sports", number: "2", source: "list"},
+				"Shows":      library,
+			},
+			keeps: map[string]string{"World News": "World News", "Shows": "Shows"},
+		},
+	}
+
+	ids := lineupIDs(t, service)
+	for _, step := range steps {
+		summary, err := service.ImportChannels(ctx, "", jsonmodels.ChannelsJson{Channels: step.channels})
+		if step.wantErr != "" {
+			if !apperrors.Is(err, step.wantErr) {
+				t.Errorf("%s: got %v, want %s", step.name, err, step.wantErr)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		} else if summary != step.want {
+			t.Errorf("%s: got %s, want %s", step.name, summary, step.want)
+		}
+
+		channels, err := service.ChannelRepo.FetchChannels(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]channelState, len(channels))
+		for _, channel := range channels {
+			got[channel.Name] = channelState{slug: channel.Slug, number: channel.Number, source: channel.Source}
+		}
+		if len(got) != len(step.lineup) {
+			t.Errorf("%s: got channels %v, want %v", step.name, got, step.lineup)
+		}
+		for name, want := range step.lineup {
+			if got[name] != want {
+				t.Errorf("%s: got %s as %+v, want %+v", step.name, name, got[name], want)
+			}
+		}
+
+		next := lineupIDs(t, service)
+		for name, previous := range step.keeps {
+			if next[name] != ids[previous] {
+				t.Errorf("%s: %s has ID %d, want the %d of %s", step.name, name, next[name], ids[previous], previous)
+			}
+		}
+		ids = next
+	}
+}
+
+func lineupIDs(t *testing.T, service *MediaService) map[string]int {
+	t.Helper()
+
+	channels, err := service.ChannelRepo.FetchChannels(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]int, len(channels))
+	for _, channel := range channels {
+		ids[channel.Name] = channel.ID
+	}
+	return ids
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle counts failed attempts per key, like a profile or a client, and
+// locks a key out for a while once it fails limit times in a row. Every
+// lockout lasts twice as long as the one before, up to maxLockout, until the
+// key succeeds.
+type throttle struct {
+	mu         sync.Mutex
+	limit      int
+	lockout    time.Duration
+	maxLockout time.Duration
+	keys       map[string]*throttleState
+}
+
+type throttleState struct {
+	failures    int
+	lockouts    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+func newThrottle(limit int, lockout time.Duration, maxLockout time.Duration) *throttle {
+	return &throttle{
+		limit:      limit,
+		lockout:    lockout,
+		maxLockout: maxLockout,
+		keys:       make(map[string]*throttleState),
+	}
+}
+
+// wait returns how long the longest locked out of keys is still locked out,
+// or 0 if none of them are.
+func (t *throttle) wait(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	var longest time.Duration
+	for _, key := range keys {
+		if state, ok := t.keys[key]; ok && state.lockedUntil.Sub(now) > longest {
+			longest = state.lockedUntil.Sub(now)
+		}
+	}
+	return longest
+}
+
+// fail records a failed attempt for each of keys.
+func (t *throttle) fail(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		state, ok := t.keys[key]
+		if !ok {
+			state = &throttleState{}
+			t.keys[key] = state
+		}
+
+		state.failures++
+		state.lastFailure = now
+		if state.failures < t.limit {
+			continue
+		}
+
+		lockout := t.lockout << state.lockouts
+		if lockout > t.maxLockout || lockout <= 0 {
+			lockout = t.maxLockout
+		}
+		state.failures = 0
+		state.lockouts++
+		state.lockedUntil = now.Add(lockout)
+	}
+
+	// Keys nobody has failed with for a while are forgotten, so clients
+	// that come and go don't pile up
+	for key, state := range t.keys {
+		if now.After(state.lockedUntil) && now.Sub(state.lastFailure) > t.maxLockout {
+			delete(t.keys, key)
+		}
+	}
+}
+
+// succeed clears the failed attempts of keys.
+func (t *throttle) succeed(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.keys, key)
+	}
+}
@@ -1,13 +1,23 @@
 const YOUTUBE_BASE_VIDEO_URL = 'https://www.youtube.com/watch?v=';
 const IFRAME_API_URL = 'https://www.youtube.com/iframe_api';
+const HLS_JS_URL = 'https://cdn.jsdelivr.net/npm/hls.js@1/dist/hls.min.js';
+const MEDIA_ERROR_OFFSET = 1000;
 const BUFFERING_TIMEOUT = 3500;
 const CHANNELS_ENDPOINT = '/api/channels';
 const CURRENT_VIDEO_ENDPOINT = '/api/current-video';
 const SUBMIT_VIDEO_ENDPOINT = '/api/submit-list';
 const INVALIDATE_VIDEO_ENDPOINT = '/api/invalidate-video';
+const LOGIN_ENDPOINT = '/api/login';
+const LOGOUT_ENDPOINT = '/api/logout';
+const OIDC_LOGIN_ENDPOINT = '/api/oidc/login';
+const PROFILES_ENDPOINT = '/api/profiles';
+const LINEUP_ENDPOINT = '/api/me/lineup';
+// Entries rated above the max rating of the profile come as filler
+const FILLER_SOURCE = 'filler';
 const VOLUME_STEPS = 5;
 const VOLUME_BAR_TIMEOUT = 2000;
 const CHANNEL_NAME_TIMEOUT = 3000;
+const CHANNEL_NUMBER_TIMEOUT = 1500;
 const INTERVAL_CHECK_MS = 1000;
 
 const ICONS = {
@@ -46,32 +56,175 @@ const initializePlayer = (playerElementId, onReady, onStateChange, onError) => {
   });
 };
 
+const loadHlsJs = () =>
+  new Promise((resolve, reject) => {
+    if (window.Hls) return resolve();
+    const tag = document.createElement('script');
+    tag.src = HLS_JS_URL;
+    tag.onload = resolve;
+    tag.onerror = reject;
+    document.head.appendChild(tag);
+  });
+
+// Wraps a <video> element in the subset of the YouTube player API used here,
+// so direct media files and HLS streams can be played in place of YouTube.
+const initializeMediaPlayer = (mediaElementId, onStateChange, onError) => {
+  const element = document.getElementById(mediaElementId);
+  let hls = null;
+  let videoData = { title: '' };
+
+  const player = {
+    cueVideo: async (video) => {
+      if (hls) {
+        hls.destroy();
+        hls = null;
+      }
+      videoData = { title: decodeURIComponent(video.url.split('/').pop()) };
+      element.addEventListener(
+        'loadedmetadata',
+        () => {
+          element.currentTime = video.sectionStart;
+        },
+        { once: true }
+      );
+
+      if (
+        video.source === 'hls' &&
+        !element.canPlayType('application/vnd.apple.mpegurl')
+      ) {
+        await loadHlsJs();
+        hls = new Hls();
+        hls.loadSource(video.url);
+        hls.attachMedia(element);
+      } else {
+        element.src = video.url;
+      }
+    },
+    stopVideo: () => {
+      if (hls) {
+        hls.destroy();
+        hls = null;
+      }
+      element.pause();
+      element.removeAttribute('src');
+      element.load();
+    },
+    playVideo: () => element.play().catch(() => {}),
+    pauseVideo: () => element.pause(),
+    mute: () => {
+      element.muted = true;
+    },
+    unMute: () => {
+      element.muted = false;
+    },
+    isMuted: () => element.muted,
+    getVolume: () => Math.round(element.volume * 100),
+    setVolume: (volume) => {
+      element.volume = volume / 100;
+    },
+    getCurrentTime: () => element.currentTime,
+    getVideoData: () => videoData
+  };
+
+  const emit = (data) => onStateChange({ target: player, data });
+  element.addEventListener('playing', () => emit(YT.PlayerState.PLAYING));
+  element.addEventListener('pause', () => emit(YT.PlayerState.PAUSED));
+  element.addEventListener('waiting', () => emit(YT.PlayerState.BUFFERING));
+  element.addEventListener('ended', () => emit(YT.PlayerState.ENDED));
+  element.addEventListener('error', () => {
+    if (element.error) {
+      onError({ data: MEDIA_ERROR_OFFSET + element.error.code });
+    }
+  });
+
+  return player;
+};
+
+const isPlayable = (video) =>
+  !!video && (!!video.id || video.source === FILLER_SOURCE);
+
+// Cue a video on the player that can play its source, hiding the other one
+const cueVideo = (state, video) => {
+  clearTimeout(state.fillerTimeout);
+  state.filler = video.source === FILLER_SOURCE;
+  if (state.filler) {
+    // Show static for as long as the entry runs, then tune in again, so the
+    // channel stays in step with everyone else
+    state.player.pauseVideo();
+    showBuffering();
+    state.fillerTimeout = setTimeout(async () => {
+      const { newChannel, newVideo } = await changeChannel(state, 0);
+      state.currentChannel = newChannel;
+      state.currentVideo = newVideo;
+    }, (video.sectionEnd - video.sectionStart) * 1000);
+    return;
+  }
+
+  const isYouTube = video.source === 'youtube';
+  const nextPlayer = isYouTube ? state.youtubePlayer : state.mediaPlayer;
+
+  if (state.player !== nextPlayer) {
+    const volume = state.player.getVolume();
+    state.player.stopVideo();
+    nextPlayer.setVolume(volume);
+    state.player = nextPlayer;
+  }
+
+  document.querySelector('#player').classList.toggle('hidden', !isYouTube);
+  document.querySelector('#media-player').classList.toggle('hidden', isYouTube);
+
+  if (isYouTube) {
+    state.player.cueVideoById({
+      videoId: video.id,
+      startSeconds: video.sectionStart
+    });
+  } else {
+    state.player.cueVideo(video);
+  }
+};
+
 const fetchChannels = async () => {
   const res = await fetch(CHANNELS_ENDPOINT);
   const data = await res.json();
   return data.channels || [];
 };
 
-const fetchCurrentVideo = async (channelId, videoId) => {
-  const url = `${CURRENT_VIDEO_ENDPOINT}?channel-id=${channelId}${
-    videoId ? `&video-id=${videoId}` : ''
+const fetchCurrentVideo = async (channel, entryId) => {
+  const url = `${CURRENT_VIDEO_ENDPOINT}?channel=${encodeURIComponent(
+    channel.slug
+  )}${
+    entryId ? `&entry-id=${entryId}` : ''
   }`;
   const res = await fetch(url);
   const data = await res.json();
   return data.video || null;
 };
 
-const handleUnavailableVideo = async (state) => {
-  const url = `${INVALIDATE_VIDEO_ENDPOINT}?video-id=${state.currentVideo.id}`;
+const handleUnavailableVideo = async (state, errorCode) => {
+  const url = `${INVALIDATE_VIDEO_ENDPOINT}?video-id=${state.currentVideo.id}&error-code=${errorCode}`;
   const res = await fetch(url, {
     method: 'DELETE'
   });
   const data = await res.json();
 
-  if (data.success) {
+  if (!data.success) return;
+
+  if (data.quarantined) {
     const { newChannel, newVideo } = await changeChannel(state, 0);
     state.currentChannel = newChannel;
     state.currentVideo = newVideo;
+    return;
+  }
+
+  // the video is still on air for everyone else, so skip ahead locally
+  const nextVideo = await fetchCurrentVideo(
+    state.currentChannel,
+    state.currentVideo.entryId
+  );
+  if (isPlayable(nextVideo) && nextVideo.id !== state.currentVideo.id) {
+    cueVideo(state, nextVideo);
+    if (!state.filler) state.player.playVideo();
+    state.currentVideo = nextVideo;
   }
 };
 
@@ -91,6 +244,7 @@ const deactiveBuffering = (state) => {
   player.mute();
 
   setTimeout(() => {
+    if (state.filler) return;
     hideBuffering();
     if (state.isInteracted && !state.isMuted) {
       // browsers prevent autoplay without user interaction
@@ -163,9 +317,9 @@ const updateChannelList = (state, channels) => {
       channelListItem.classList.add('active');
     }
 
-    channelListItem.innerHTML = `${channel.id.toString().padStart(2, '0')} - ${
-      channel.name
-    }`;
+    channelListItem.innerHTML = `${channel.favorite ? '★ ' : ''}${channelLabel(
+      channel
+    )} - ${channel.name}`;
     channelListItem.addEventListener('click', async () => {
       const { newChannel, newVideo } = await jumpToChannel(state, channel.id);
 
@@ -212,9 +366,23 @@ const toggleControlGroup = (isMinimized) => {
   return isMinimized;
 };
 
+// Channels without a number of their own are shown by their ID
+const channelLabel = (channel) =>
+  channel.number || channel.id.toString().padStart(2, '0');
+
+// Finds a channel by slug, channel number or ID, like the API does
+const findChannel = (channels, ref) =>
+  channels.find((channel) => channel.slug === ref) ||
+  channels.find((channel) => channel.number === ref) ||
+  channels.find((channel) => channel.id.toString() === ref);
+
 const updateChannelName = (channel) => {
-  const channelId = channel.id.toString().padStart(2, '0');
-  const channelName = `${channelId} - ${channel.name}`;
+  const channelName = `${channelLabel(channel)} - ${channel.name}`;
+  // Keep the address bar pointing at the channel so it can be bookmarked
+  const url = new URL(window.location.href);
+  url.searchParams.set('channel', channel.slug);
+  window.history.replaceState(null, '', url);
+
   const channelNameElement = document.querySelector('#channel-name');
   if (channelNameElement) {
     channelNameElement.innerHTML = channelName;
@@ -232,50 +400,70 @@ const togglePlayPause = (player, isPlaying) => {
   return !isPlaying;
 };
 
+const playChannelVideo = (state, video) => {
+  cueVideo(state, video);
+  if (state.filler) return;
+  state.player.mute();
+  state.player.playVideo();
+  if (state.isInteracted && !state.isMuted) {
+    state.muted = false;
+    state.player.unMute();
+  }
+};
+
 // Switch to the next or previous channel
 const changeChannel = async (state, offset) => {
-  const { player, channels, currentChannel } = state;
+  const { channels, currentChannel } = state;
   const currentIndex = channels.findIndex(
     (channel) => channel.id === currentChannel.id
   );
   const newIndex = (currentIndex + offset + channels.length) % channels.length;
   const newChannel = channels[newIndex];
-  const newVideo = await fetchCurrentVideo(newChannel.id);
-  if (newVideo) {
-    const videoId = newVideo.id;
-    if (videoId) {
-      player.cueVideoById({ videoId, startSeconds: newVideo.sectionStart });
-      player.mute();
-      player.playVideo();
-      if (state.isInteracted && !state.isMuted) {
-        state.muted = false;
-        player.unMute();
-      }
-    }
+  const newVideo = await fetchCurrentVideo(newChannel);
+  if (isPlayable(newVideo)) {
+    playChannelVideo(state, newVideo);
   }
   return { newChannel, newVideo };
 };
 
 const jumpToChannel = async (state, channelId) => {
-  const { player, channels } = state;
+  const { channels } = state;
   const newChannel = channels.find((channel) => channel.id === channelId);
-  const newVideo = await fetchCurrentVideo(newChannel.id);
-  if (newVideo) {
-    const videoId = newVideo.id;
-    if (videoId) {
-      player.cueVideoById({ videoId, startSeconds: newVideo.sectionStart });
-      player.mute();
-      player.playVideo();
-
-      if (state.isInteracted && !state.isMuted) {
-        state.muted = false;
-        player.unMute();
-      }
-    }
+  const newVideo = await fetchCurrentVideo(newChannel);
+  if (isPlayable(newVideo)) {
+    playChannelVideo(state, newVideo);
   }
   return { newChannel, newVideo };
 };
 
+// Digits typed on the keyboard tune to a channel number, like a TV remote
+const enterChannelNumber = (state, key) => {
+  state.channelNumberInput += key;
+  clearTimeout(state.channelNumberTimeout);
+
+  const channelNameElement = document.querySelector('#channel-name');
+  if (channelNameElement) {
+    channelNameElement.innerHTML = `${state.channelNumberInput}-`;
+    channelNameElement.classList.add('active');
+  }
+
+  state.channelNumberTimeout = setTimeout(async () => {
+    const channel = state.channels.find(
+      (channel) => channel.number === state.channelNumberInput
+    );
+    state.channelNumberInput = '';
+    if (!channel) {
+      channelNameElement?.classList.remove('active');
+      return;
+    }
+
+    const { newChannel, newVideo } = await jumpToChannel(state, channel.id);
+    state.currentChannel = newChannel;
+    state.currentVideo = newVideo;
+    updateChannelName(newChannel);
+  }, CHANNEL_NUMBER_TIMEOUT);
+};
+
 const closeInfoModal = () => {
   const infoPopup = document.querySelector('#info-modal-container');
   infoPopup.classList.remove('active');
@@ -328,6 +516,8 @@ const submitVideoLink = async () => {
     videoListInput.value = '';
     closeSettingsModal();
     location.reload();
+  } else if (data.error) {
+    console.error('Failed to submit video list:', data.error.message);
   }
 };
 
@@ -342,15 +532,201 @@ const fetchConfig = async () => {
   }
 };
 
+const login = async () => {
+  const nameInput = document.querySelector('#admin-name-input');
+  const passwordInput = document.querySelector('#admin-password-input');
+
+  const res = await fetch(LOGIN_ENDPOINT, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json'
+    },
+    body: JSON.stringify({
+      name: nameInput.value.trim(),
+      password: passwordInput.value
+    })
+  });
+  const data = await res.json();
+  passwordInput.value = '';
+  if (data.success) {
+    location.reload();
+  } else if (data.error) {
+    console.error('Failed to sign in:', data.error.message);
+  }
+};
+
+const fetchProfiles = async () => {
+  const res = await fetch(PROFILES_ENDPOINT);
+  const data = await res.json();
+  return data.profiles || [];
+};
+
+const switchProfile = async () => {
+  const profileSelect = document.querySelector('#profile-select');
+  const pinInput = document.querySelector('#profile-pin-input');
+
+  const res = await fetch(PROFILES_ENDPOINT, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json'
+    },
+    body: JSON.stringify({ name: profileSelect.value, pin: pinInput.value })
+  });
+  const data = await res.json();
+  pinInput.value = '';
+  if (data.success) {
+    location.reload();
+  } else if (data.error) {
+    displayMessage(data.error.message, 'Profiles');
+  }
+};
+
+// Lists the viewer profiles to switch to, asking for a PIN if the picked
+// one is locked
+const updateProfiles = (state, profiles) => {
+  const profileSelect = document.querySelector('#profile-select');
+  const pinInput = document.querySelector('#profile-pin-input');
+
+  document
+    .querySelector('#profiles')
+    .classList.toggle('hidden', profiles.length === 0);
+
+  profileSelect.innerHTML = '';
+  for (const profile of profiles) {
+    const option = document.createElement('option');
+    option.value = profile.name;
+    option.textContent = profile.maxRating
+      ? `${profile.name} (up to ${profile.maxRating})`
+      : profile.name;
+    option.selected = profile.name === state.profile;
+    profileSelect.appendChild(option);
+  }
+
+  const updatePinInput = () => {
+    const profile = profiles.find((p) => p.name === profileSelect.value);
+    pinInput.classList.toggle('hidden', !profile || !profile.pin);
+  };
+  profileSelect.onchange = updatePinInput;
+  updatePinInput();
+};
+
+const fetchLineup = async () => {
+  const res = await fetch(LINEUP_ENDPOINT);
+  const data = await res.json();
+  return data.channels || [];
+};
+
+const saveLineup = async (lineup) => {
+  const res = await fetch(LINEUP_ENDPOINT, {
+    method: 'PUT',
+    headers: {
+      'Content-Type': 'application/json'
+    },
+    body: JSON.stringify({
+      channels: lineup.map(({ channel, favorite, hidden }) => ({
+        channel,
+        favorite,
+        hidden
+      }))
+    })
+  });
+  const data = await res.json();
+  if (data.error) {
+    displayMessage(data.error.message, 'Lineup');
+  } else {
+    location.reload();
+  }
+};
+
+// Lists the channels of the lineup to favorite, hide and move around. The
+// changes are kept until they are saved all at once
+const updateLineup = (state, lineup) => {
+  const lineupList = document.querySelector('#lineup-list');
+
+  // Arranging channels is closed in read-only mode, like other changes
+  document
+    .querySelector('#lineup')
+    .classList.toggle('hidden', state.readonly || lineup.length === 0);
+
+  const lineupButton = (text, title, onClick) => {
+    const button = document.createElement('button');
+    button.classList.add('lineup-button');
+    button.textContent = text;
+    button.title = title;
+    button.addEventListener('click', () => {
+      onClick();
+      render();
+    });
+    return button;
+  };
+
+  const move = (index, offset) => {
+    const target = index + offset;
+    if (target < 0 || target >= lineup.length) return;
+    [lineup[index], lineup[target]] = [lineup[target], lineup[index]];
+  };
+
+  const render = () => {
+    lineupList.innerHTML = '';
+    lineup.forEach((channel, index) => {
+      const lineupItem = document.createElement('div');
+      lineupItem.classList.add('lineup-item');
+      lineupItem.classList.toggle('muted', channel.hidden);
+
+      const label = document.createElement('span');
+      label.classList.add('lineup-label');
+      label.textContent = channel.number
+        ? `${channel.number} - ${channel.name}`
+        : channel.name;
+
+      lineupItem.append(
+        label,
+        lineupButton(channel.favorite ? '★' : '☆', 'Favorite', () => {
+          channel.favorite = !channel.favorite;
+        }),
+        lineupButton(channel.hidden ? 'Show' : 'Hide', 'Hide', () => {
+          channel.hidden = !channel.hidden;
+        }),
+        lineupButton('↑', 'Move up', () => move(index, -1)),
+        lineupButton('↓', 'Move down', () => move(index, 1))
+      );
+      lineupList.appendChild(lineupItem);
+    });
+  };
+  render();
+
+  document.querySelector('#lineup-save').onclick = () => saveLineup(lineup);
+};
+
+const logout = async () => {
+  await fetch(LOGOUT_ENDPOINT, { method: 'POST' });
+  location.reload();
+};
+
 const updateUIForReadOnlyMode = (state) => {
   submitButton = document.querySelector('#video-list-submit');
   videoListInput = document.querySelector('#video-list-input');
-  if (state.readonly) {
+
+  document
+    .querySelector('#admin-login')
+    .classList.toggle('hidden', !state.login || !!state.role);
+  document
+    .querySelector('#admin-oidc-login')
+    .classList.toggle('hidden', !state.oidc || !!state.role);
+  document
+    .querySelector('#admin-logout')
+    .classList.toggle('hidden', !state.role);
+
+  // Submitting a list replaces the lineup, which only admins may do, in
+  // read-only mode too
+  if (!state.admin) {
     submitButton.disabled = true;
     submitButton.style.opacity = '0.5';
     videoListInput.disabled = true;
     videoListInput.style.opacity = '0.5';
-    videoListInput.placeholder = 'Application is in readonly mode';
+    videoListInput.placeholder = state.role
+      ? 'Only admins can provide their own videos'
+      : 'Sign in as admin to provide your own videos';
   } else {
     submitButton.disabled = false;
     submitButton.style.opacity = '1';
@@ -461,14 +837,40 @@ const addEventListeners = (state) => {
     });
 
   document.querySelector('#video-link').addEventListener('click', () => {
-    window.open(YOUTUBE_BASE_VIDEO_URL + state.currentVideo.id, '_blank');
+    const { currentVideo } = state;
+    const url =
+      currentVideo.source === 'youtube'
+        ? YOUTUBE_BASE_VIDEO_URL + currentVideo.id
+        : currentVideo.url;
+    window.open(url, '_blank');
   });
 
   document.querySelector('#video-list-submit').addEventListener('click', () => {
     submitVideoLink();
   });
 
+  document.querySelector('#admin-login-submit').addEventListener('click', () => {
+    login();
+  });
+
+  document.querySelector('#admin-oidc-login').addEventListener('click', () => {
+    location.href = OIDC_LOGIN_ENDPOINT;
+  });
+
+  document.querySelector('#admin-logout').addEventListener('click', () => {
+    logout();
+  });
+
+  document.querySelector('#profile-switch').addEventListener('click', () => {
+    switchProfile();
+  });
+
   document.addEventListener('keydown', (event) => {
+    if (/^[0-9.]$/.test(event.key) && event.target.tagName !== 'INPUT') {
+      enterChannelNumber(state, event.key);
+      return;
+    }
+
     switch (event.key) {
       case 'ArrowLeft':
         // Change to the previous channel
@@ -524,7 +926,7 @@ const addEventListeners = (state) => {
   document.addEventListener('DOMContentLoaded', fetchConfig);
 };
 
-const initApp = async (playerElementId) => {
+const initApp = async (playerElementId, mediaElementId) => {
   const channels = await fetchChannels();
 
   if (channels.length === 0) {
@@ -532,44 +934,65 @@ const initApp = async (playerElementId) => {
     return;
   }
 
-  const randomChannel = channels[Math.floor(Math.random() * channels.length)];
+  // ?channel= picks the starting channel, otherwise start somewhere random
+  const requestedChannel = new URLSearchParams(window.location.search).get(
+    'channel'
+  );
+  const initialChannel =
+    (requestedChannel && findChannel(channels, requestedChannel)) ||
+    channels[Math.floor(Math.random() * channels.length)];
 
   const state = {
     player: null,
+    youtubePlayer: null,
+    mediaPlayer: null,
     isPlaying: false,
     isMuted: true,
     isFullscreen: false,
     isControlGroupMinimized: false,
-    currentChannel: randomChannel,
+    currentChannel: initialChannel,
     currentVideo: null,
     channels,
     isInteracted: false,
     currentVideoName: '',
-    readonly: false
+    channelNumberInput: '',
+    channelNumberTimeout: null,
+    readonly: false,
+    login: false,
+    oidc: false,
+    role: '',
+    admin: false,
+    profile: '',
+    filler: false,
+    fillerTimeout: null
   };
 
   addEventListeners(state);
   fetchConfig().then((config) => {
     state.readonly = config.readonly;
+    state.login = config.login;
+    state.oidc = config.oidc;
+    state.role = config.role;
+    state.admin = config.admin;
+    state.profile = config.profile;
     updateUIForReadOnlyMode(state);
+    fetchProfiles().then((profiles) => updateProfiles(state, profiles));
+    fetchLineup().then((lineup) => updateLineup(state, lineup));
   });
 
   const onReady = async () => {
-    const initialVideo = await fetchCurrentVideo(state.currentChannel.id);
-    if (initialVideo) {
-      const videoId = initialVideo.id;
-      if (videoId) {
-        state.player.cueVideoById({
-          videoId,
-          startSeconds: initialVideo.sectionStart
-        });
-        state.player.playVideo();
-        state.currentVideo = initialVideo;
-      }
+    const initialVideo = await fetchCurrentVideo(state.currentChannel);
+    if (isPlayable(initialVideo)) {
+      cueVideo(state, initialVideo);
+      if (!state.filler) state.player.playVideo();
+      state.currentVideo = initialVideo;
     }
   };
 
   const onStateChange = ({ target, data }) => {
+    // The player is paused behind the static while filler runs
+    if (state.filler) return;
+
     state.isPlaying = data === YT.PlayerState.PLAYING;
     state.isMuted = target.isMuted();
     state.currentVideoName = target.getVideoData().title;
@@ -588,6 +1011,10 @@ const initApp = async (playerElementId) => {
       deactiveBuffering(state);
 
       const intervalId = setInterval(async () => {
+        if (state.filler) {
+          clearInterval(intervalId);
+          return;
+        }
         const currentTime = state.player.getCurrentTime();
 
         if (
@@ -620,14 +1047,19 @@ const initApp = async (playerElementId) => {
           errorCode,
           'Video is unavailable: removed or marked as private.'
         );
-        handleUnavailableVideo(state);
+        handleUnavailableVideo(state, errorCode);
         break;
       case 101:
       case 150:
         console.error('Error code:', errorCode, 'Video cannot be embedded.');
-        handleUnavailableVideo(state);
+        handleUnavailableVideo(state, errorCode);
         break;
       default:
+        if (errorCode > MEDIA_ERROR_OFFSET) {
+          console.error('Error code:', errorCode, 'Media could not be played.');
+          handleUnavailableVideo(state, errorCode);
+          break;
+        }
         console.error(
           'Error code:',
           errorCode,
@@ -637,13 +1069,19 @@ const initApp = async (playerElementId) => {
   };
 
   loadYouTubeAPI(() => {
-    state.player = initializePlayer(
+    state.youtubePlayer = initializePlayer(
       playerElementId,
       onReady,
       onStateChange,
       onError
     );
+    state.mediaPlayer = initializeMediaPlayer(
+      mediaElementId,
+      onStateChange,
+      onError
+    );
+    state.player = state.youtubePlayer;
   });
 };
 
-initApp('player');
+initApp('player', 'media-player');